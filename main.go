@@ -1,27 +1,48 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"PromAI/pkg/api"
+	"PromAI/pkg/auth"
 	"PromAI/pkg/config"
+	"PromAI/pkg/health"
+	"PromAI/pkg/logging"
 	"PromAI/pkg/metrics"
 	"PromAI/pkg/notify"
 	"PromAI/pkg/prometheus"
+	"PromAI/pkg/redact"
 	"PromAI/pkg/report"
+	"PromAI/pkg/server"
 	"PromAI/pkg/status"
 	"PromAI/pkg/taskmanager"
+	"PromAI/pkg/telemetry"
 	"PromAI/pkg/utils"
 
 	"github.com/robfig/cron/v3"
@@ -30,88 +51,1284 @@ import (
 
 // loadConfig 加载配置文件
 func loadConfig(path string) (*config.Config, error) {
-	data, err := os.ReadFile(path) // 读取配置文件
+	config, err := config.Load(path) // 读取、严格解析并校验配置文件及 include 引入的指标文件
 	if err != nil {
-		return nil, fmt.Errorf("reading config file: %w", err)
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
 	}
+	// 从环境变量中获取 PrometheusURL
+	if envPrometheusURL := os.Getenv("PROMETHEUS_URL"); envPrometheusURL != "" {
+		slog.Info("使用环境变量中的 Prometheus URL", logging.KeyDatasource, envPrometheusURL)
+		config.PrometheusURL = envPrometheusURL
+		config.SetSource("prometheus_url", sourceEnv, "PROMETHEUS_URL")
+	} else {
+		slog.Info("使用配置文件中的 Prometheus URL", logging.KeyDatasource, config.PrometheusURL)
+	}
+	for _, warning := range config.Warnings() {
+		slog.Warn("配置项已废弃", "location", fieldLocation(path, warning), "detail", warning.Message)
+	}
+	registerSecrets(config)
+	return config, nil // 返回配置结构体
+}
+
+// fieldLocation 返回配置项所在的文件、行号和路径，include 引入文件中的配置项使用该文件的路径
+func fieldLocation(configPath string, fe config.FieldError) string {
+	location := configPath
+	if fe.File != "" {
+		location = fe.File
+	}
+	if fe.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, fe.Line)
+	}
+	if fe.Path != "" {
+		location += ": " + fe.Path
+	}
+	return location
+}
+
+// registerSecrets 将配置中的密码、签名密钥和API令牌注册为敏感值，使其不出现在日志和任务记录中
+// webhook 中的 access_token/key 参数和URL中的密码由脱敏规则统一处理
+func registerSecrets(config *config.Config) {
+	redact.Register(
+		config.Notifications.Dingtalk.Secret,
+		config.Notifications.Email.Password,
+		config.PrometheusAuth.BasicAuth.Password,
+		config.PrometheusAuth.BearerToken,
+	)
+	for _, ds := range config.DataSources {
+		redact.Register(ds.Auth.BasicAuth.Password, ds.Auth.BearerToken)
+	}
+	for _, t := range config.Auth.Tokens {
+		redact.Register(t.Token)
+	}
+}
+
+// datasourcePolicy 请求中自定义数据源URL的访问策略，根据 datasource_policy 配置创建，重新加载配置时替换
+var datasourcePolicy atomic.Pointer[prometheus.URLPolicy]
+
+// setup 初始化应用程序
+func setup(configPath string) (*prometheus.Client, *config.Config, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading config: %w", err)
+	}
+
+	if config.Server.BasePath, err = server.NormalizeBasePath(config.Server.BasePath); err != nil {
+		return nil, nil, err
+	}
+	if config.Server.ExternalURL, err = server.NormalizeExternalURL(config.Server.ExternalURL); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := prometheus.NewClientWithAuth(config.PrometheusURL, config.PrometheusAuth)
+	if err != nil {
+		return nil, nil, fmt.Errorf("initializing Prometheus client: %w", err)
+	}
+	return client, config, nil
+}
+
+// runHashPassword 从标准输入读取密码并输出 bcrypt 哈希，用于配置 auth.basic_users
+func runHashPassword() {
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		fatal("Failed to read password", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		fatal("Password must not be empty", nil)
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		fatal("Failed to hash password", err)
+	}
+	fmt.Println(hash)
+}
+
+// runValidate 校验配置文件，逐行输出带行号的错误，存在错误时以非零状态退出，用于 CI 检查
+func runValidate(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := flags.String("config", "config/config.yaml", "配置文件路径")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		var validationErr *config.ValidationError
+		if !errors.As(err, &validationErr) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+			os.Exit(2)
+		}
+		printFieldErrors(*configPath, validationErr.Errors)
+		fmt.Fprintf(os.Stderr, "%d error(s)\n", len(validationErr.Errors))
+		os.Exit(1)
+	}
+	for _, warning := range cfg.Warnings() {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", fieldLocation(*configPath, warning), warning.Message)
+	}
+	fmt.Printf("%s: OK\n", *configPath)
+}
+
+// printFieldErrors 逐行输出带文件、行号和路径的配置错误
+func printFieldErrors(configPath string, errs []config.FieldError) {
+	for _, fe := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fieldLocation(configPath, fe), fe.Message)
+	}
+}
+
+// runConfig 处理 config 子命令，目前只有 migrate
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, "usage: promai config migrate [-config path] [-dry-run] [-backup=false]")
+		os.Exit(2)
+	}
+	runMigrate(args[1:])
+}
+
+// runMigrate 将配置文件及其 include 引入的指标文件、overlay 文件升级到最新的格式版本，逐项输出修改
+// 写入后重新加载配置确认可用；存在无法自动修改的配置项或写入后的配置无效时以状态 1 退出
+func runMigrate(args []string) {
+	flags := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	configPath := flags.String("config", "config/config.yaml", "配置文件路径")
+	dryRun := flags.Bool("dry-run", false, "只输出需要修改的内容，不写入文件")
+	backup := flags.Bool("backup", true, "写入前将原文件保存为 <文件名>.bak")
+	flags.Parse(args)
+
+	migrations, err := config.MigrateFiles(*configPath)
+	if err != nil {
+		var validationErr *config.ValidationError
+		if !errors.As(err, &validationErr) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+			os.Exit(2)
+		}
+		printFieldErrors(*configPath, validationErr.Errors)
+		fmt.Fprintf(os.Stderr, "%d item(s) need manual changes, nothing was written\n", len(validationErr.Errors))
+		os.Exit(1)
+	}
+	if len(migrations) == 0 {
+		fmt.Printf("%s: already at version %d\n", *configPath, config.CurrentVersion)
+		return
+	}
+
+	for _, migration := range migrations {
+		for _, change := range migration.Changes {
+			fmt.Printf("%s: %s\n", fieldLocation(*configPath, change), change.Message)
+		}
+	}
+	if *dryRun {
+		return
+	}
+	for _, migration := range migrations {
+		if err := migration.Write(*backup); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Printf("%s: upgraded to version %d\n", migration.File, config.CurrentVersion)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		os.Exit(1)
+	}
+	for _, warning := range cfg.Warnings() {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", fieldLocation(*configPath, warning), warning.Message)
+	}
+}
+
+// runPacks 列出内置规则包，指定名称时输出该规则包的内容，便于在 metric_types 中按指标类型和指标名称覆盖
+func runPacks(args []string) {
+	if len(args) > 0 {
+		data, err := config.PackSource(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
+	packs, err := config.Packs()
+	if err != nil {
+		fatal("Failed to load packs", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tMETRICS\tDESCRIPTION")
+	for _, pack := range packs {
+		metrics := 0
+		for _, mt := range pack.MetricTypes {
+			metrics += len(mt.Metrics)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", pack.Name, pack.Version, metrics, pack.Description)
+	}
+	w.Flush()
+}
+
+// runPreview 在数据源上试运行配置中的指标或文件中的指标定义，输出每条记录的取值和状态，不生成报告
+// 数据源拒绝查询时以状态 1 退出，无法加载配置或连接数据源时以状态 2 退出
+func runPreview(args []string) {
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	configPath := flags.String("config", "config/config.yaml", "配置文件路径")
+	datasource := flags.String("datasource", "", "数据源名称或URL，为空时使用 prometheus_url")
+	metricRef := flags.String("metric", "", "配置中的指标，格式为 <指标类型>/<指标名称>")
+	metricFile := flags.String("file", "", "指标定义文件（YAML 或 JSON），- 表示标准输入")
+	output := flags.String("output", "table", "输出格式: table、json")
+	flags.Parse(args)
+
+	exit := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if (*metricRef == "") == (*metricFile == "") {
+		exit(errors.New("exactly one of -metric and -file is required"))
+	}
+	logging.Setup(logging.Config{Level: "warn"})
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		exit(err)
+	}
+	policy, err := prometheus.NewURLPolicy(cfg.DatasourcePolicy)
+	if err != nil {
+		exit(err)
+	}
+	datasourcePolicy.Store(policy)
+
+	var metric config.MetricConfig
+	if *metricRef != "" {
+		typeName, name, _ := strings.Cut(*metricRef, "/")
+		mt, exists := config.FindMetricType(cfg.MetricTypes, typeName)
+		index := config.FindMetric(mt.Metrics, name)
+		if !exists || index < 0 {
+			exit(fmt.Errorf("metric %q not found in %s", *metricRef, *configPath))
+		}
+		metric = mt.Metrics[index]
+	} else {
+		var data []byte
+		if *metricFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(*metricFile)
+		}
+		if err != nil {
+			exit(err)
+		}
+		if err := yaml.UnmarshalStrict(data, &metric); err != nil {
+			exit(fmt.Errorf("parsing metric definition: %w", err))
+		}
+	}
+
+	client, err := datasourceClient(cfg, *datasource)
+	if err != nil {
+		exit(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metricQueryTimeout)
+	defer cancel()
+	preview, err := metrics.PreviewMetric(ctx, client.API, metric)
+	if err != nil {
+		exit(fmt.Errorf("querying datasource failed: %w", err))
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(metricPreviewResult{Datasource: datasourceLabel(*datasource), Preview: preview})
+	} else {
+		printPreview(preview)
+	}
+	if preview.Error != "" {
+		os.Exit(1)
+	}
+}
+
+// printPreview 以表格输出试运行结果，列为标签显示名、取值和状态
+func printPreview(preview *metrics.Preview) {
+	for _, warning := range preview.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	if preview.Error != "" {
+		fmt.Fprintf(os.Stderr, "error: %s\n", preview.Error)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(preview.Rows) > 0 {
+		for _, label := range preview.Rows[0].Labels {
+			fmt.Fprintf(w, "%s\t", label.Alias)
+		}
+		fmt.Fprintln(w, "VALUE\tSTATUS")
+	}
+	for _, row := range preview.Rows {
+		for _, label := range row.Labels {
+			fmt.Fprintf(w, "%s\t", label.Value)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", strconv.FormatFloat(row.Value, 'f', -1, 64)+preview.Metric.Unit, row.Status)
+	}
+	w.Flush()
+
+	statuses := make([]string, 0, len(preview.Summary))
+	for status, count := range preview.Summary {
+		statuses = append(statuses, fmt.Sprintf("%s=%d", status, count))
+	}
+	sort.Strings(statuses)
+	fmt.Printf("\n%d row(s) %s, query took %.1fms\n", len(preview.Rows), strings.Join(statuses, " "), preview.LatencyMs)
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		runHashPassword()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		runValidate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "packs" {
+		runPacks(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		runPreview(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfig(os.Args[2:])
+		return
+	}
+
+	// 设置命令行参数
+	configPath := flag.String("config", "config/config.yaml", "配置文件路径")
+	port := flag.String("port", ":8091", "服务端口")
+	logLevel := flag.String("log-level", "", "日志级别: debug、info、warn、error，覆盖配置文件中的 log.level")
+	logFormat := flag.String("log-format", "", "日志格式: text、json，覆盖配置文件中的 log.format")
+	watchInterval := flag.Duration("config-watch-interval", 10*time.Second, "检查配置文件变化的间隔，内容变化时自动重新加载，0 表示不监听")
+	flag.Parse()
+
+	// 先按命令行参数初始化日志，加载配置后再合并配置文件中的日志设置
+	logFlags := logging.Config{Level: *logLevel, Format: *logFormat}
+	if err := logging.Setup(logFlags); err != nil {
+		fatal("Invalid log flags", err)
+	}
+
+	// 初始化应用程序：加载配置并创建客户端、路由和定时任务
+	reloader := &configReloader{path: *configPath, port: *port, logFlags: logFlags}
+	current, err := reloader.load(nil)
+	if err != nil {
+		fatal("Failed to setup application", err)
+	}
+	config := current.config
+
+	// 设置全局端口、路由前缀和对外地址，修改后需要重启服务
+	utils.SetGlobalPort(strings.TrimPrefix(*port, ":"))
+	utils.SetBasePath(config.Server.BasePath)
+	utils.SetExternalURL(config.Server.ExternalURL)
+
+	var certReloader *server.CertReloader
+	if config.Server.TLS.Enabled() {
+		if certReloader, err = server.NewCertReloader(config.Server.TLS); err != nil {
+			fatal("Failed to setup TLS", err)
+		}
+	}
+
+	// 启用配置：替换数据源策略和日志设置，启动定时任务
+	reloader.activate(current)
+	telemetry.ObserveConfigLoad()
+
+	// 启动 HTTP 服务器
+	datasourceNames := make([]string, 0, len(config.DataSources))
+	for _, ds := range config.DataSources {
+		datasourceNames = append(datasourceNames, ds.Name)
+	}
+	var notifyChannels []string
+	if config.Notifications.Dingtalk.Enabled {
+		notifyChannels = append(notifyChannels, notifyChannelDingtalk)
+	}
+	if config.Notifications.Email.Enabled {
+		notifyChannels = append(notifyChannels, notifyChannelEmail)
+	}
+	if config.Notifications.WeChatWork.Enabled {
+		notifyChannels = append(notifyChannels, notifyChannelWeChatWork)
+	}
+	cleanup := "disabled"
+	if config.ReportCleanup.Enabled {
+		cleanup = config.ReportCleanup.CronSchedule
+	}
+	slog.Info("PromAI 系统监控平台启动成功",
+		"port", *port,
+		"url", serverURL(config, *port),
+		"tls", certReloader != nil,
+		logging.KeyDatasource, config.PrometheusURL,
+		"datasources", datasourceNames,
+		"datasource_policy", datasourcePolicy.Load().Mode(),
+		"cron_schedule", config.CronSchedule,
+		"report_cleanup", cleanup,
+		"notifications", notifyChannels,
+		"auth", current.auth != nil,
+		"config_watch_interval", *watchInterval,
+	)
+	if current.auth != nil {
+		slog.Info("认证已启用", "tokens", len(config.Auth.Tokens), "basic_users", len(config.Auth.BasicUsers), "proxy", config.Auth.Proxy.Enabled)
+	} else {
+		slog.Warn("认证未启用，所有页面和接口允许匿名访问")
+	}
+	for _, endpoint := range []string{
+		"GET " + config.Server.BasePath + "/",
+		"GET " + config.Server.BasePath + "/progress",
+		"GET " + config.Server.BasePath + "/reports/history",
+		"GET " + config.Server.BasePath + "/getreport",
+		"GET " + config.Server.BasePath + "/reports/list",
+		"GET " + config.Server.BasePath + "/status",
+		"GET " + config.Server.BasePath + "/tasks/{id}/events",
+		"POST " + config.Server.BasePath + "/tasks/{id}/retry",
+		"GET " + config.Server.BasePath + "/tasks/stats",
+		"GET " + config.Server.BasePath + "/reports/",
+		"GET " + config.Server.BasePath + "/" + api.Version + "/openapi.json",
+		"GET " + config.Server.BasePath + "/" + api.Version + "/getreport",
+		"GET " + config.Server.BasePath + "/" + api.Version + "/reports",
+		"GET " + config.Server.BasePath + "/" + api.Version + "/tasks",
+		"GET " + config.Server.BasePath + "/config",
+		"GET " + config.Server.BasePath + "/config/overlay",
+		"GET " + config.Server.BasePath + "/metric-types",
+		"POST " + config.Server.BasePath + "/metric-types",
+		"GET " + config.Server.BasePath + "/metric-types/{type}",
+		"POST " + config.Server.BasePath + "/metrics/preview",
+		"POST " + config.Server.BasePath + "/config/reload",
+		"GET /metrics",
+		"GET /healthz",
+		"GET /readyz",
+	} {
+		slog.Debug("注册接口", "endpoint", endpoint)
+	}
+
+	// 关闭时取消全部请求上下文，结束仍在推送的任务事件流
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		Addr: *port,
+		// 请求交给当前生效配置的路由处理，重新加载配置后新请求使用新的路由
+		Handler:     reloader,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	httpServer.RegisterOnShutdown(cancelRequests)
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 配置文件内容变化或收到 SIGHUP 时重新加载配置
+	reloader.watch(signalCtx, *watchInterval)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if certReloader != nil {
+			httpServer.TLSConfig = certReloader.TLSConfig()
+			serverErr <- httpServer.ListenAndServeTLS("", "")
+			return
+		}
+		serverErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("Failed to start server", err)
+	case <-signalCtx.Done():
+		stop()
+	}
+
+	gracePeriod := time.Duration(config.ShutdownGracePeriod) * time.Second
+	if gracePeriod <= 0 {
+		gracePeriod = 30 * time.Second
+	}
+	shutdown(httpServer, reloader, gracePeriod)
+}
+
+// shutdown 停止接受新的巡检和定时任务，在宽限期内等待执行中的巡检和通知完成后关闭HTTP服务
+// 宽限期结束仍未完成的任务会被取消并记录为失败
+func shutdown(httpServer *http.Server, reloader *configReloader, gracePeriod time.Duration) {
+	slog.Info("收到退出信号，开始优雅关闭", "grace_period", gracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	tm := taskmanager.GlobalTaskManager
+	tm.StartDrain()
+
+	cronDone := reloader.stopSchedulers()
+
+	if err := tm.Wait(ctx); err != nil {
+		running := tm.GetRunningTasks()
+		for _, task := range running {
+			tm.CancelTask(task.ID)
+		}
+		slog.Warn("宽限期内巡检未完成，已取消", "tasks", len(running))
+	} else {
+		slog.Info("执行中的巡检已全部完成")
+	}
+	for _, done := range cronDone {
+		select {
+		case <-done.Done():
+		case <-ctx.Done():
+		}
+	}
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP服务未能在宽限期内关闭，强制关闭连接", logging.Err(err))
+		httpServer.Close()
+	}
+	slog.Info("服务已停止")
+}
+
+// 重新加载配置的触发来源，记录在日志中
+const (
+	reloadSourceFile   = "file"
+	reloadSourceSignal = "sighup"
+	reloadSourceAPI    = "api"
+)
+
+// 配置项来源，loadConfig 和 load 中的局部变量 config 会遮蔽包名
+const (
+	sourceEnv  = config.SourceEnv
+	sourceFlag = config.SourceFlag
+)
+
+// app 一份配置及根据它创建的客户端、收集器、路由和定时任务，重新加载配置时整体替换
+// 执行中的巡检继续使用开始时的配置，不受重新加载影响
+type app struct {
+	config     *config.Config
+	client     *prometheus.Client
+	collector  *metrics.Collector
+	policy     *prometheus.URLPolicy
+	auth       *auth.Middleware
+	handler    http.Handler
+	schedulers []*cron.Cron
+	loadedAt   time.Time
+}
+
+// configReloader 加载配置文件并原子替换当前生效的 app，新配置无效时保留当前配置
+type configReloader struct {
+	path     string
+	port     string         // -port 参数，服务实际监听的端口
+	logFlags logging.Config // 命令行指定的日志设置，优先于配置文件
+
+	mu      sync.Mutex // 串行化重新加载，并与关闭流程互斥
+	editMu  sync.Mutex // 串行化通过接口修改 overlay 文件
+	stopped bool       // 服务关闭中，不再重新加载
+	current atomic.Pointer[app]
+}
+
+// ServeHTTP 将请求交给当前生效配置的路由处理
+func (rl *configReloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rl.current.Load().handler.ServeHTTP(w, r)
+}
+
+// load 加载并校验配置文件，创建对应的客户端、路由和定时任务（定时任务尚未启动）
+// previous 为当前生效的配置，server 配置修改后需要重启才能生效，重新加载时沿用 previous 中的设置
+func (rl *configReloader) load(previous *config.Config) (*app, error) {
+	client, config, err := setup(rl.path)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && !reflect.DeepEqual(config.Server, previous.Server) {
+		slog.Warn("server 配置修改后需要重启服务才能生效，继续使用当前设置")
+		config.Server = previous.Server
+	}
+	// 命令行参数优先于配置文件，记录来源便于在 /config 中查看实际生效的值
+	config.Port = rl.port
+	config.SetSource("port", sourceFlag, "-port")
+	if rl.logFlags.Level != "" {
+		config.Log.Level = rl.logFlags.Level
+		config.SetSource("log.level", sourceFlag, "-log-level")
+	}
+	if rl.logFlags.Format != "" {
+		config.Log.Format = rl.logFlags.Format
+		config.SetSource("log.format", sourceFlag, "-log-format")
+	}
+
+	policy, err := prometheus.NewURLPolicy(config.DatasourcePolicy)
+	if err != nil {
+		return nil, fmt.Errorf("setting up datasource policy: %w", err)
+	}
+	authMiddleware, err := auth.New(config.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("setting up auth: %w", err)
+	}
+
+	collector := metrics.NewCollector(client.API, config)
+	mux := http.NewServeMux()
+	if err := setupRoutes(mux, collector, config, rl); err != nil {
+		return nil, err
+	}
+	schedulers, err := newSchedulers(collector, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &app{
+		config:    config,
+		client:    client,
+		collector: collector,
+		policy:    policy,
+		auth:      authMiddleware,
+		// 认证中间件统一作用于页面、JSON接口和报告文件，探针接口无需认证
+		handler:    withProbes(client, config, authMiddleware.Wrap(mux)),
+		schedulers: schedulers,
+		loadedAt:   time.Now(),
+	}, nil
+}
+
+// activate 启用新的 app：替换数据源策略、日志设置和路由，停止上一份配置的定时任务后启动新的定时任务
+func (rl *configReloader) activate(next *app) {
+	datasourcePolicy.Store(next.policy)
+
+	if err := logging.Setup(next.config.Log); err != nil {
+		slog.Warn("日志设置无效，继续使用当前日志设置", logging.Err(err))
+	}
+
+	previous := rl.current.Swap(next)
+	if previous != nil {
+		for _, c := range previous.schedulers {
+			c.Stop()
+		}
+	}
+	for _, c := range next.schedulers {
+		c.Start()
+	}
+}
+
+// Reload 重新加载配置文件，新配置无效时保留当前配置并返回错误
+func (rl *configReloader) Reload(source string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.stopped || taskmanager.GlobalTaskManager.ShuttingDown() {
+		return taskmanager.ErrShuttingDown
+	}
+
+	next, err := rl.load(rl.current.Load().config)
+	telemetry.ObserveConfigReload(err)
+	if err != nil {
+		slog.Error("重新加载配置失败，继续使用当前配置", "source", source, "path", rl.path, logging.Err(err))
+		return err
+	}
+	rl.activate(next)
+	slog.Info("配置已重新加载", "source", source, "path", rl.path,
+		"metric_types", len(next.config.MetricTypes), "datasources", len(next.config.DataSources),
+		"cron_schedule", next.config.CronSchedule)
+	return nil
+}
+
+// watch 在配置文件或引入的指标文件内容变化、收到 SIGHUP 时重新加载配置，interval 为 0 时不监听文件
+func (rl *configReloader) watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				rl.Reload(reloadSourceSignal)
+			}
+		}
+	}()
+
+	if interval > 0 {
+		// 同时检查 include 引入的文件，通配符每次重新匹配，新增或删除文件也会触发重新加载
+		files := func() []string {
+			current := rl.current.Load().config
+			files := append([]string{rl.path}, config.IncludeFiles(rl.path, current.Include)...)
+			// overlay 文件在第一次通过接口修改指标时才创建
+			if overlay := current.OverlayPath(); overlay != "" {
+				if _, err := os.Stat(overlay); err == nil {
+					files = append(files, overlay)
+				}
+			}
+			return files
+		}
+		go config.WatchFiles(ctx, files, interval, func() {
+			rl.Reload(reloadSourceFile)
+		})
+	}
+}
+
+// stopSchedulers 停止当前的定时任务并禁止之后的重新加载，返回的 context 在执行中的定时任务结束后关闭
+func (rl *configReloader) stopSchedulers() []context.Context {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.stopped = true
+	schedulers := rl.current.Load().schedulers
+	done := make([]context.Context, 0, len(schedulers))
+	for _, c := range schedulers {
+		done = append(done, c.Stop())
+	}
+	return done
+}
+
+// reloadResult 重新加载配置成功时的响应
+type reloadResult struct {
+	Status   string    `json:"status"`
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// reloadHandler 处理 POST /config/reload，新配置无效时返回 422 及每项错误，当前配置保持不变
+func (rl *configReloader) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	logRequest(r)
+	if r.Method != http.MethodPost {
+		api.MethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if !auth.Allowed(r, auth.PermReloadConfig) {
+		auth.Forbid(w, r, "reloading config requires admin role")
+		return
+	}
+
+	if err := rl.Reload(reloadSourceAPI); err != nil {
+		writeReloadError(w, r, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, reloadResult{Status: "success", LoadedAt: rl.current.Load().loadedAt})
+}
+
+// effectiveConfig GET /config 的响应：当前生效的完整配置（已隐藏密码和令牌）及其来源
+type effectiveConfig struct {
+	File     string          `json:"file" yaml:"file"`
+	Hash     string          `json:"hash" yaml:"hash"`
+	LoadedAt time.Time       `json:"loadedAt" yaml:"loaded_at"`
+	Sources  []config.Source `json:"sources" yaml:"sources"`
+	// Warnings 旧版本配置项的废弃警告，配置已在内存中升级到最新版本
+	Warnings []config.FieldError `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+	Config   interface{}         `json:"config" yaml:"config"` // YAML 保持配置文件中的字段顺序
+}
+
+// configHandler 处理 GET /config，返回合并 include、规则包、环境变量和命令行参数后实际生效的配置
+// 默认返回 JSON，format=yaml 或 Accept 包含 yaml 时返回 YAML
+func (rl *configReloader) configHandler(w http.ResponseWriter, r *http.Request) {
+	logRequest(r)
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	if !auth.Allowed(r, auth.PermViewConfig) {
+		auth.Forbid(w, r, "viewing config requires operator or admin role")
+		return
+	}
+
+	current := rl.current.Load()
+	masked, err := current.config.Masked()
+	if err != nil {
+		api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, err.Error(), nil)
+		return
+	}
+	result := effectiveConfig{
+		File:     rl.path,
+		Hash:     current.config.Hash(),
+		LoadedAt: current.loadedAt,
+		Sources:  current.config.Sources(),
+		Warnings: current.config.Warnings(),
+	}
+	if result.Sources == nil {
+		result.Sources = []config.Source{}
+	}
+
+	if r.URL.Query().Get("format") == "yaml" || strings.Contains(r.Header.Get("Accept"), "yaml") {
+		result.Config = masked
+		data, err := yaml.Marshal(result)
+		if err != nil {
+			api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, err.Error(), nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+		w.Write(data)
+		return
+	}
+	result.Config = config.ToJSONValue(masked)
+	api.WriteJSON(w, http.StatusOK, result)
+}
+
+// writeReloadError 返回重新加载配置失败的原因，新配置无效时返回 422 及每项错误
+func writeReloadError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *config.ValidationError
+	switch {
+	case errors.Is(err, taskmanager.ErrShuttingDown):
+		api.WriteError(w, r, http.StatusServiceUnavailable, api.CodeShuttingDown, "Server is shutting down", nil)
+	case errors.As(err, &validationErr):
+		api.WriteError(w, r, http.StatusUnprocessableEntity, api.CodeInvalidConfig,
+			"Invalid configuration, keeping the current one", validationErr.Errors)
+	default:
+		api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, err.Error(), nil)
+	}
+}
+
+// metricEditError 编辑指标定义时请求本身的错误，如指标类型不存在或名称冲突
+type metricEditError struct {
+	status  int
+	code    string
+	message string
+	details interface{}
+}
+
+func (e *metricEditError) Error() string {
+	return e.message
+}
+
+// metricTypeNotFound 返回指标类型不存在的错误
+func metricTypeNotFound(name string) *metricEditError {
+	return &metricEditError{http.StatusNotFound, api.CodeNotFound, "Metric type not found", map[string]string{"type": name}}
+}
+
+// metricNotFound 返回指标不存在的错误
+func metricNotFound(typeName, name string) *metricEditError {
+	return &metricEditError{http.StatusNotFound, api.CodeNotFound, "Metric not found", map[string]string{"type": typeName, "metric": name}}
+}
+
+// metricTypesHandler 处理 /metric-types：GET 列出当前生效的指标类型，POST 新增指标类型
+func (rl *configReloader) metricTypesHandler(w http.ResponseWriter, r *http.Request) {
+	logRequest(r)
+	if !allowMetricDefinitions(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		api.WriteJSON(w, http.StatusOK, rl.current.Load().config.MetricTypes)
+
+	case http.MethodPost:
+		var mt config.MetricType
+		if err := json.NewDecoder(r.Body).Decode(&mt); err != nil {
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Invalid request body", err.Error())
+			return
+		}
+		rl.editMetrics(w, r, http.StatusCreated, func(types []config.MetricType, overlay *config.Overlay) (interface{}, []config.MetricConfig, error) {
+			if _, exists := config.FindMetricType(types, mt.Type); exists {
+				return nil, nil, &metricEditError{http.StatusConflict, api.CodeConflict, "Metric type already exists", map[string]string{"type": mt.Type}}
+			}
+			overlay.SetMetricType(mt)
+			return mt, mt.Metrics, nil
+		})
+
+	default:
+		api.MethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// allowMetricDefinitions 查看指标定义与 GET /config 一样需要 view_config 权限，修改的权限在 editMetrics 中检查
+func allowMetricDefinitions(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet && !auth.Allowed(r, auth.PermViewConfig) {
+		auth.Forbid(w, r, "viewing metric definitions requires operator or admin role")
+		return false
+	}
+	return true
+}
+
+func (rl *configReloader) makeMetricTypeHandler(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rl.metricTypeHandler(w, r, prefix)
+	}
+}
+
+// metricTypeHandler 处理 /metric-types/{type} 和 /metric-types/{type}/metrics/{name}，名称需要 URL 编码
+func (rl *configReloader) metricTypeHandler(w http.ResponseWriter, r *http.Request, prefix string) {
+	logRequest(r)
+	if !allowMetricDefinitions(w, r) {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Invalid path", err.Error())
+			return
+		}
+		parts[i] = unescaped
+	}
+	typeName := parts[0]
+	if typeName == "" || len(parts) > 3 || (len(parts) > 1 && parts[1] != "metrics") {
+		api.WriteError(w, r, http.StatusNotFound, api.CodeNotFound, "Not found", nil)
+		return
+	}
+
+	current := rl.current.Load().config
+	switch {
+	case len(parts) == 1:
+		rl.metricTypeItemHandler(w, r, current, typeName)
+	case len(parts) == 2 || parts[2] == "":
+		rl.metricsHandler(w, r, current, typeName)
+	default:
+		rl.metricItemHandler(w, r, current, typeName, parts[2])
+	}
+}
+
+// metricTypeItemHandler 查看、替换或删除指标类型，替换时请求体中的 type 不同表示重命名
+func (rl *configReloader) metricTypeItemHandler(w http.ResponseWriter, r *http.Request, current *config.Config, typeName string) {
+	switch r.Method {
+	case http.MethodGet:
+		mt, exists := config.FindMetricType(current.MetricTypes, typeName)
+		if !exists {
+			err := metricTypeNotFound(typeName)
+			api.WriteError(w, r, err.status, err.code, err.message, err.details)
+			return
+		}
+		api.WriteJSON(w, http.StatusOK, mt)
+
+	case http.MethodPut:
+		var mt config.MetricType
+		if err := json.NewDecoder(r.Body).Decode(&mt); err != nil {
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Invalid request body", err.Error())
+			return
+		}
+		if mt.Type == "" {
+			mt.Type = typeName
+		}
+		rl.editMetrics(w, r, http.StatusOK, func(types []config.MetricType, overlay *config.Overlay) (interface{}, []config.MetricConfig, error) {
+			if _, exists := config.FindMetricType(types, typeName); !exists {
+				return nil, nil, metricTypeNotFound(typeName)
+			}
+			if mt.Type != typeName {
+				if _, exists := config.FindMetricType(types, mt.Type); exists {
+					return nil, nil, &metricEditError{http.StatusConflict, api.CodeConflict, "Metric type already exists", map[string]string{"type": mt.Type}}
+				}
+				overlay.DeleteMetricType(typeName, baseHasMetricType(current, typeName))
+			}
+			overlay.SetMetricType(mt)
+			return mt, mt.Metrics, nil
+		})
+
+	case http.MethodDelete:
+		rl.editMetrics(w, r, http.StatusNoContent, func(types []config.MetricType, overlay *config.Overlay) (interface{}, []config.MetricConfig, error) {
+			if _, exists := config.FindMetricType(types, typeName); !exists {
+				return nil, nil, metricTypeNotFound(typeName)
+			}
+			overlay.DeleteMetricType(typeName, baseHasMetricType(current, typeName))
+			return nil, nil, nil
+		})
+
+	default:
+		api.MethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// metricsHandler 列出指标类型下的指标或新增指标
+func (rl *configReloader) metricsHandler(w http.ResponseWriter, r *http.Request, current *config.Config, typeName string) {
+	switch r.Method {
+	case http.MethodGet:
+		mt, exists := config.FindMetricType(current.MetricTypes, typeName)
+		if !exists {
+			err := metricTypeNotFound(typeName)
+			api.WriteError(w, r, err.status, err.code, err.message, err.details)
+			return
+		}
+		api.WriteJSON(w, http.StatusOK, mt.Metrics)
+
+	case http.MethodPost:
+		var metric config.MetricConfig
+		if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Invalid request body", err.Error())
+			return
+		}
+		rl.editMetrics(w, r, http.StatusCreated, func(types []config.MetricType, overlay *config.Overlay) (interface{}, []config.MetricConfig, error) {
+			mt, exists := config.FindMetricType(types, typeName)
+			if !exists {
+				return nil, nil, metricTypeNotFound(typeName)
+			}
+			if config.FindMetric(mt.Metrics, metric.Name) >= 0 {
+				return nil, nil, &metricEditError{http.StatusConflict, api.CodeConflict, "Metric already exists",
+					map[string]string{"type": typeName, "metric": metric.Name}}
+			}
+			mt.Metrics = append(append([]config.MetricConfig(nil), mt.Metrics...), metric)
+			overlay.SetMetricType(mt)
+			return metric, []config.MetricConfig{metric}, nil
+		})
+
+	default:
+		api.MethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// metricItemHandler 查看、替换或删除单个指标，替换时请求体中的 name 不同表示重命名
+func (rl *configReloader) metricItemHandler(w http.ResponseWriter, r *http.Request, current *config.Config, typeName, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		mt, exists := config.FindMetricType(current.MetricTypes, typeName)
+		index := config.FindMetric(mt.Metrics, name)
+		if !exists || index < 0 {
+			err := metricNotFound(typeName, name)
+			api.WriteError(w, r, err.status, err.code, err.message, err.details)
+			return
+		}
+		api.WriteJSON(w, http.StatusOK, mt.Metrics[index])
+
+	case http.MethodPut:
+		var metric config.MetricConfig
+		if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Invalid request body", err.Error())
+			return
+		}
+		if metric.Name == "" {
+			metric.Name = name
+		}
+		rl.editMetrics(w, r, http.StatusOK, func(types []config.MetricType, overlay *config.Overlay) (interface{}, []config.MetricConfig, error) {
+			mt, exists := config.FindMetricType(types, typeName)
+			index := config.FindMetric(mt.Metrics, name)
+			if !exists || index < 0 {
+				return nil, nil, metricNotFound(typeName, name)
+			}
+			if metric.Name != name && config.FindMetric(mt.Metrics, metric.Name) >= 0 {
+				return nil, nil, &metricEditError{http.StatusConflict, api.CodeConflict, "Metric already exists",
+					map[string]string{"type": typeName, "metric": metric.Name}}
+			}
+			mt.Metrics = append([]config.MetricConfig(nil), mt.Metrics...)
+			mt.Metrics[index] = metric
+			overlay.SetMetricType(mt)
+			return metric, []config.MetricConfig{metric}, nil
+		})
+
+	case http.MethodDelete:
+		rl.editMetrics(w, r, http.StatusNoContent, func(types []config.MetricType, overlay *config.Overlay) (interface{}, []config.MetricConfig, error) {
+			mt, exists := config.FindMetricType(types, typeName)
+			index := config.FindMetric(mt.Metrics, name)
+			if !exists || index < 0 {
+				return nil, nil, metricNotFound(typeName, name)
+			}
+			mt.Metrics = append(append([]config.MetricConfig(nil), mt.Metrics[:index]...), mt.Metrics[index+1:]...)
+			overlay.SetMetricType(mt)
+			return nil, nil, nil
+		})
 
-	var config config.Config // 定义配置结构体
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("parsing config file: %w", err)
-	} // 解析配置文件
-	// 从环境变量中获取 PrometheusURL
-	if envPrometheusURL := os.Getenv("PROMETHEUS_URL"); envPrometheusURL != "" {
-		log.Printf("使用环境变量中的 Prometheus URL: %s", envPrometheusURL)
-		config.PrometheusURL = envPrometheusURL
-	} else {
-		log.Printf("使用配置文件中的 Prometheus URL: %s", config.PrometheusURL)
+	default:
+		api.MethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
 	}
-	return &config, nil // 返回配置结构体
 }
 
-// setup 初始化应用程序
-func setup(configPath string) (*prometheus.Client, *config.Config, error) {
-	config, err := loadConfig(configPath)
+// baseHasMetricType 判断配置文件（含 include 和规则包）中是否定义了该指标类型
+func baseHasMetricType(current *config.Config, name string) bool {
+	_, exists := config.FindMetricType(current.BaseMetricTypes(), name)
+	return exists
+}
+
+// metricEditFunc 在当前生效的指标类型上修改 overlay，返回响应内容及需要在数据源上校验的指标
+type metricEditFunc func(types []config.MetricType, overlay *config.Overlay) (interface{}, []config.MetricConfig, error)
+
+// editMetrics 修改 overlay 文件中的指标定义：校验修改后的完整配置，并在 datasource 参数指定的数据源上执行修改的查询，
+// 全部通过后写入 overlay 文件并重新加载配置；任一步失败时 overlay 文件和当前配置保持不变
+func (rl *configReloader) editMetrics(w http.ResponseWriter, r *http.Request, status int, edit metricEditFunc) {
+	if !auth.Allowed(r, auth.PermEditMetrics) {
+		auth.Forbid(w, r, "editing metrics requires admin role")
+		return
+	}
+	datasource := r.URL.Query().Get("datasource")
+	if !authorizeDatasource(w, r, datasource) {
+		return
+	}
+
+	rl.editMu.Lock()
+	defer rl.editMu.Unlock()
+
+	current := rl.current.Load().config
+	path := current.OverlayPath()
+	if path == "" {
+		api.WriteError(w, r, http.StatusConflict, api.CodeConflict, "Editing metrics requires overlay_file in the config file", nil)
+		return
+	}
+	overlay, err := config.LoadOverlay(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("loading config: %w", err)
+		writeReloadError(w, r, err)
+		return
+	}
+
+	result, changed, err := edit(current.MetricTypes, overlay)
+	var editErr *metricEditError
+	if errors.As(err, &editErr) {
+		api.WriteError(w, r, editErr.status, editErr.code, editErr.message, editErr.details)
+		return
+	} else if err != nil {
+		// 修改可能只应用了一部分，不能继续保存
+		api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, err.Error(), nil)
+		return
+	}
+
+	// 校验应用修改后的完整配置，错误路径中的下标与 GET /metric-types 的顺序一致
+	candidate := *current
+	candidate.MetricTypes = overlay.Apply(current.BaseMetricTypes())
+	if errs := candidate.Validate(); len(errs) > 0 {
+		api.WriteError(w, r, http.StatusUnprocessableEntity, api.CodeInvalidConfig, "Invalid metric definition", errs)
+		return
+	}
+	if !checkMetricQueries(w, r, current, datasource, changed) {
+		return
 	}
 
-	client, err := prometheus.NewClient(config.PrometheusURL)
+	previous, err := config.SnapshotOverlay(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("initializing Prometheus client: %w", err)
+		api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, err.Error(), nil)
+		return
 	}
-	return client, config, nil
+	if err := overlay.Save(path); err != nil {
+		api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, err.Error(), nil)
+		return
+	}
+	if err := rl.Reload(reloadSourceAPI); err != nil {
+		// 配置文件本身被改坏等原因导致无法重新加载时恢复 overlay 文件
+		if restoreErr := previous.Restore(); restoreErr != nil {
+			slog.Error("恢复 overlay 文件失败，文件中保留了未生效的修改", "overlay_file", path, "reload_error", err, logging.Err(restoreErr))
+			api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal,
+				"Reloading config failed and the overlay file could not be restored, it still contains this change",
+				map[string]string{"overlayFile": path, "reloadError": err.Error(), "restoreError": restoreErr.Error()})
+			return
+		}
+		writeReloadError(w, r, err)
+		return
+	}
+	slog.Info("指标定义已修改", "method", r.Method, "path", r.URL.Path, "overlay_file", path)
+
+	if result == nil {
+		w.WriteHeader(status)
+		return
+	}
+	api.WriteJSON(w, status, result)
 }
 
-func main() {
-	// 设置命令行参数
-	configPath := flag.String("config", "config/config.yaml", "配置文件路径")
-	port := flag.String("port", ":8091", "服务端口")
-	flag.Parse()
+// metricQueryTimeout 在数据源上校验或试运行单个查询的超时时间
+const metricQueryTimeout = 30 * time.Second
 
-	// 初始化应用程序
-	client, config, err := setup(*configPath)
+// checkMetricQueries 在数据源上执行指标的查询，数据源拒绝查询时返回 422 及每个查询的错误，无法连接数据源时返回 502
+func checkMetricQueries(w http.ResponseWriter, r *http.Request, current *config.Config, datasource string, changed []config.MetricConfig) bool {
+	if len(changed) == 0 {
+		return true
+	}
+	client, err := datasourceClient(current, datasource)
 	if err != nil {
-		log.Fatalf("Failed to setup application: %v", err)
+		writeDatasourceError(w, r, datasource, err)
+		return false
 	}
 
-	// 创建指标收集器
-	collector := metrics.NewCollector(client.API, config)
+	var errs []config.FieldError
+	for _, metric := range changed {
+		ctx, cancel := context.WithTimeout(r.Context(), metricQueryTimeout)
+		warnings, err := metrics.CheckQuery(ctx, client.API, metric.Query)
+		cancel()
+		switch {
+		case errors.Is(err, metrics.ErrInvalidQuery):
+			errs = append(errs, config.FieldError{Path: "query", Message: fmt.Sprintf("%s: %v", metric.Name, err)})
+		case err != nil:
+			api.WriteError(w, r, http.StatusBadGateway, api.CodeDatasourceError,
+				fmt.Sprintf("Querying datasource failed: %v", err), map[string]string{"datasource": datasourceLabel(datasource)})
+			return false
+		case len(warnings) > 0:
+			slog.Warn("数据源返回查询警告", logging.KeyMetric, metric.Name, "warnings", warnings)
+		}
+	}
+	if len(errs) > 0 {
+		api.WriteError(w, r, http.StatusUnprocessableEntity, api.CodeInvalidConfig, "Query rejected by datasource", errs)
+		return false
+	}
+	return true
+}
 
-	// 设置全局端口
-	utils.SetGlobalPort(strings.TrimPrefix(*port, ":"))
+// metricPreviewRequest POST /metrics/preview 的请求体
+type metricPreviewRequest struct {
+	Datasource string              `json:"datasource"`
+	Metric     config.MetricConfig `json:"metric"`
+}
 
-	// 设置 HTTP 路由
-	setupRoutes(collector, config)
+// metricPreviewResult 试运行结果及使用的数据源
+type metricPreviewResult struct {
+	Datasource string `json:"datasource"`
+	*metrics.Preview
+}
 
-	// 如果配置了定时任务，启动定时执行
-	if config.CronSchedule != "" {
-		c := cron.New()
-		_, err := c.AddFunc(config.CronSchedule, func() {
-			log.Printf("开始执行定时巡检任务...")
-			data, err := collector.CollectMetrics()
-			if err != nil {
-				log.Printf("Error collecting metrics: %v", err)
-				return
-			}
+func makeMetricPreviewHandler(config *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricPreviewHandler(w, r, config)
+	}
+}
 
-			reportFilePath, err := report.GenerateReport(*data)
-			if err != nil {
-				log.Printf("Error generating report: %v", err)
-				return
-			}
+// metricPreviewHandler 处理 POST /metrics/preview，在数据源上试运行请求中的指标定义，
+// 返回每条记录的取值和状态、校验问题和查询耗时，不生成报告
+func metricPreviewHandler(w http.ResponseWriter, r *http.Request, config *config.Config) {
+	logRequest(r)
+	if r.Method != http.MethodPost {
+		api.MethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	var req metricPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Metric.Query) == "" {
+		api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "metric.query is required", nil)
+		return
+	}
 
-			// 发送通知
-			sendNotifications(config, reportFilePath, data)
-			log.Printf("定时巡检任务完成，报告已生成: %s", reportFilePath)
-		})
+	if !auth.Allowed(r, auth.PermInspect) {
+		auth.Forbid(w, r, "previewing metrics requires operator role")
+		return
+	}
+	if !authorizeDatasource(w, r, req.Datasource) {
+		return
+	}
+	client, err := datasourceClient(config, req.Datasource)
+	if err != nil {
+		writeDatasourceError(w, r, req.Datasource, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metricQueryTimeout)
+	defer cancel()
+	preview, err := metrics.PreviewMetric(ctx, client.API, req.Metric)
+	if err != nil {
+		api.WriteError(w, r, http.StatusBadGateway, api.CodeDatasourceError,
+			fmt.Sprintf("Querying datasource failed: %v", err), map[string]string{"datasource": datasourceLabel(req.Datasource)})
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, metricPreviewResult{Datasource: datasourceLabel(req.Datasource), Preview: preview})
+}
 
+// overlayResult GET /config/overlay 的响应
+type overlayResult struct {
+	File    string                  `json:"file"`
+	Overlay *config.Overlay         `json:"overlay"`
+	Diff    []config.MetricTypeDiff `json:"diff"`
+}
+
+// overlayHandler 处理 GET /config/overlay，返回 overlay 文件内容及其相对配置文件的修改
+func (rl *configReloader) overlayHandler(w http.ResponseWriter, r *http.Request) {
+	logRequest(r)
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	if !auth.Allowed(r, auth.PermViewConfig) {
+		auth.Forbid(w, r, "viewing config requires operator or admin role")
+		return
+	}
+
+	current := rl.current.Load().config
+	result := overlayResult{File: current.OverlayPath(), Overlay: &config.Overlay{}}
+	if result.File != "" {
+		overlay, err := config.LoadOverlay(result.File)
 		if err != nil {
-			log.Printf("Failed to schedule cron job: %v", err)
-		} else {
-			c.Start()
-			log.Printf("定时任务已启动，执行周期: %s", config.CronSchedule)
+			writeReloadError(w, r, err)
+			return
+		}
+		result.Overlay = overlay
+	}
+	result.Diff = config.DiffMetricTypes(current.BaseMetricTypes(), current.MetricTypes)
+	api.WriteJSON(w, http.StatusOK, result)
+}
+
+// newSchedulers 创建定时巡检和报告清理任务，由 activate 启动
+func newSchedulers(collector *metrics.Collector, config *config.Config) ([]*cron.Cron, error) {
+	var schedulers []*cron.Cron
+
+	// 如果配置了定时任务，定时执行巡检
+	if config.CronSchedule != "" {
+		c := cron.New()
+		if _, err := c.AddFunc(config.CronSchedule, func() {
+			runScheduledInspection(collector, config)
+		}); err != nil {
+			return nil, fmt.Errorf("setting up cron_schedule %q: %w", config.CronSchedule, err)
 		}
+		schedulers = append(schedulers, c)
+		slog.Info("定时任务已启动", "cron_schedule", config.CronSchedule)
 	}
 
 	// 配置报告清理
@@ -121,380 +1338,801 @@ func main() {
 			cleanupSchedule = "0 2 * * *" // 默认每天凌晨2点清理
 		}
 
-		if cleanupSchedule != "" {
-			c := cron.New()
-			_, err := c.AddFunc(cleanupSchedule, func() {
-				if err := report.CleanupReports(config.ReportCleanup.MaxAge); err != nil {
-					log.Printf("报告清理失败: %v", err)
-					return
-				}
-				log.Printf("报告清理成功")
-			})
-
+		c := cron.New()
+		if _, err := c.AddFunc(cleanupSchedule, func() {
+			err := report.CleanupReports(config.ReportCleanup.MaxAge)
+			telemetry.ObserveSchedule(telemetry.ScheduleReportCleanup, err == nil)
 			if err != nil {
-				log.Printf("设置清理定时任务失败: %v", err)
-			} else {
-				c.Start()
-				log.Printf("报告清理定时任务已启动，执行周期: %s", cleanupSchedule)
+				slog.Error("报告清理失败", logging.Err(err))
+				return
 			}
+			slog.Info("报告清理成功")
+		}); err != nil {
+			return nil, fmt.Errorf("setting up report_cleanup.cron_schedule %q: %w", cleanupSchedule, err)
 		}
+		schedulers = append(schedulers, c)
+		slog.Info("报告清理定时任务已启动", "cron_schedule", cleanupSchedule)
 	}
+	return schedulers, nil
+}
 
-	// 启动 HTTP 服务器
-	log.Printf("==========================================")
-	log.Printf("PromAI 系统监控平台启动成功！")
-	log.Printf("==========================================")
-	log.Printf("服务端口: %s", *port)
-	log.Printf("")
-	log.Printf("访问地址:")
-	log.Printf("  首页: http://localhost%s/api/promai", *port)
-	log.Printf("  巡检进度: http://localhost%s/api/promai/progress", *port)
-	log.Printf("  历史报告: http://localhost%s/api/promai/reports/history", *port)
-	log.Printf("")
-	log.Printf("API接口:")
-	log.Printf("  生成报告: GET http://localhost%s/api/promai/getreport", *port)
-	log.Printf("  报告列表: GET http://localhost%s/api/promai/reports/list", *port)
-	log.Printf("  状态页面: GET http://localhost%s/api/promai/status", *port)
-	log.Printf("  静态文件: http://localhost%s/api/promai/reports/", *port)
-	log.Printf("")
-	log.Printf("数据源配置:")
-	log.Printf("  默认数据源: %s", config.PrometheusURL)
-	if len(config.DataSources) > 0 {
-		log.Printf("  额外数据源:")
-		for _, ds := range config.DataSources {
-			log.Printf("    - %s: %s", ds.Name, ds.URL)
-		}
-	}
-	log.Printf("")
-	log.Printf("定时任务:")
-	if config.CronSchedule != "" {
-		log.Printf("  巡检任务: %s", config.CronSchedule)
-	} else {
-		log.Printf("  巡检任务: 未配置")
+// serverURL 返回启动日志中展示的首页地址，优先使用 server.external_url
+func serverURL(config *config.Config, port string) string {
+	if config.Server.ExternalURL != "" {
+		return config.Server.ExternalURL + config.Server.BasePath + "/"
 	}
-	if config.ReportCleanup.Enabled {
-		log.Printf("  报告清理: %s", config.ReportCleanup.CronSchedule)
+	scheme := "http"
+	if config.Server.TLS.Enabled() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost%s%s/", scheme, port, config.Server.BasePath)
+}
+
+// fatal 记录错误日志后退出进程
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, logging.Err(err))
 	} else {
-		log.Printf("  报告清理: 未启用")
+		slog.Error(msg)
 	}
-	log.Printf("")
-	log.Printf("通知配置:")
-	if config.Notifications.Dingtalk.Enabled {
-		log.Printf("  钉钉通知: 已启用")
+	os.Exit(1)
+}
+
+// logRequest 记录API访问日志
+func logRequest(r *http.Request) {
+	user := "anonymous"
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		user = identity.Name
 	}
-	if config.Notifications.Email.Enabled {
-		log.Printf("  邮件通知: 已启用")
+	slog.Info("API请求", logging.KeyMethod, r.Method, logging.KeyPath, r.URL.Path, logging.KeyRemote, r.RemoteAddr, logging.KeyUser, user)
+}
+
+// 页面模板，就绪检查会逐个解析
+var pageTemplates = []string{
+	"templates/index.html",
+	"templates/progress.html",
+	"templates/reports.html",
+	"templates/status.html",
+	"templates/report.html",
+}
+
+// statusTemplateFuncs 状态页面模板使用的函数
+var statusTemplateFuncs = template.FuncMap{
+	"now": time.Now,
+	"date": func(format string, t time.Time) string {
+		return t.Format(format)
+	},
+}
+
+// withProbes 在认证之前注册 /healthz 和 /readyz，供 Kubernetes 探针匿名访问
+func withProbes(client *prometheus.Client, config *config.Config, next http.Handler) http.Handler {
+	timeout := time.Duration(config.Health.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
 	}
-	if config.Notifications.WeChatWork.Enabled {
-		log.Printf("  企业微信: 已启用")
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", health.LivenessHandler())
+	mux.Handle("/readyz", health.ReadinessHandler(func() []health.Check {
+		return readinessChecks(client, config)
+	}, timeout))
+	mux.Handle("/", next)
+	return mux
+}
+
+// readinessChecks 就绪检查项：配置已加载、模板可解析、报告目录可写，以及可选的数据源 buildinfo 检查
+func readinessChecks(client *prometheus.Client, config *config.Config) []health.Check {
+	checks := []health.Check{
+		{Name: "shutdown", Func: func(ctx context.Context) error {
+			if taskmanager.GlobalTaskManager.ShuttingDown() {
+				return taskmanager.ErrShuttingDown
+			}
+			return nil
+		}},
+		{Name: "config", Func: func(ctx context.Context) error {
+			if len(config.MetricTypes) == 0 {
+				return fmt.Errorf("no metric_types configured")
+			}
+			return nil
+		}},
+		{Name: "templates", Func: health.TemplatesParse(pageTemplates, statusTemplateFuncs)},
+		{Name: "reports_dir", Func: health.DirWritable("reports")},
+	}
+	if !config.Health.CheckDatasources {
+		return checks
 	}
-	log.Printf("==========================================")
-	log.Printf("服务器正在运行...")
 
-	if err := http.ListenAndServe(*port, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	checks = append(checks, health.Check{Name: "datasource:" + auth.DefaultDatasource, Func: health.PrometheusBuildinfo(client.API)})
+	for _, ds := range config.DataSources {
+		ds := ds
+		checks = append(checks, health.Check{Name: "datasource:" + ds.Name, Func: func(ctx context.Context) error {
+			dsClient, err := prometheus.NewClientWithAuth(ds.URL, ds.Auth)
+			if err != nil {
+				return err
+			}
+			return health.PrometheusBuildinfo(dsClient.API)(ctx)
+		}})
 	}
+	return checks
 }
 
-// setupRoutes 设置 HTTP 路由
-func setupRoutes(collector *metrics.Collector, config *config.Config) {
+// setupRoutes 在 mux 上设置 HTTP 路由，每次加载配置都会创建新的 mux
+func setupRoutes(mux *http.ServeMux, collector *metrics.Collector, config *config.Config, reloader *configReloader) error {
+	// 所有路由至少需要查看权限，发起巡检、自定义数据源和取消任务等操作在处理器中按角色和数据源范围检查
+	view := func(handler http.Handler) http.Handler {
+		return auth.Require(auth.PermView, handler)
+	}
+
+	base := config.Server.BasePath
+
 	// 设置首页路由
-	http.HandleFunc("/api/promai/", indexHandler)
-	http.HandleFunc("/api/promai/index", indexHandler)
+	mux.Handle(base+"/", view(http.HandlerFunc(indexHandler)))
+	mux.Handle(base+"/index", view(http.HandlerFunc(indexHandler)))
 
 	// 设置报告生成路由
-	http.HandleFunc("/api/promai/getreport", makeReportHandler(collector, config))
+	mux.Handle(base+"/getreport", view(makeReportHandler(collector, config)))
 
 	// 设置报告列表API
-	http.HandleFunc("/api/promai/reports/list", reportsListHandler)
+	mux.Handle(base+"/reports/list", view(http.HandlerFunc(reportsListHandler)))
 
 	// 设置最近活动API
-	http.HandleFunc("/api/promai/activities", recentActivitiesHandler)
+	mux.Handle(base+"/activities", view(http.HandlerFunc(recentActivitiesHandler)))
 
-	// 设置静态文件服务
-	http.Handle("/api/promai/reports/", http.StripPrefix("/api/promai/reports/", http.FileServer(http.Dir("reports"))))
+	// 设置静态文件服务，只返回请求方数据源范围内的报告
+	mux.Handle(base+"/reports/", view(http.StripPrefix(base+"/reports/", reportFileHandler("reports"))))
 
 	// 设置进度页面路由
-	http.HandleFunc("/api/promai/progress", progressHandler)
+	mux.Handle(base+"/progress", view(http.HandlerFunc(progressHandler)))
 
 	// 设置历史报告页面路由
-	http.HandleFunc("/api/promai/reports/history", reportsHandler)
+	mux.Handle(base+"/reports/history", view(http.HandlerFunc(reportsHandler)))
 
 	// 设置状态页面路由
-	http.HandleFunc("/api/promai/status", makeStatusHandler(collector.Client, config))
+	mux.Handle(base+"/status", view(makeStatusHandler(collector.Client, config)))
 
 	// 设置任务管理相关API
-	http.HandleFunc("/api/promai/tasks", tasksHandler)
-	http.HandleFunc("/api/promai/tasks/", taskDetailHandler)
+	mux.Handle(base+"/tasks", view(makeTasksHandler(config)))
+	mux.Handle(base+"/tasks/", view(makeTaskDetailHandler(collector, config, base+"/tasks/")))
 
+	// 版本化API，与上面未带版本的接口共用处理器，OpenAPI 文档描述的是这一组接口
+	v1 := base + "/" + api.Version
+	openapiHandler, err := api.OpenAPIHandler(base)
+	if err != nil {
+		return fmt.Errorf("loading OpenAPI document: %w", err)
+	}
+	mux.Handle(v1+"/openapi.json", view(openapiHandler))
+	mux.Handle(v1+"/getreport", view(makeReportHandler(collector, config)))
+	mux.Handle(v1+"/reports", view(http.HandlerFunc(reportsListHandler)))
+	mux.Handle(v1+"/activities", view(http.HandlerFunc(recentActivitiesHandler)))
+	mux.Handle(v1+"/tasks", view(makeTasksHandler(config)))
+	mux.Handle(v1+"/tasks/", view(makeTaskDetailHandler(collector, config, v1+"/tasks/")))
+
+	// 试运行单个指标定义，需要 operator 角色
+	mux.Handle(base+"/metrics/preview", view(makeMetricPreviewHandler(config)))
+	mux.Handle(v1+"/metrics/preview", view(makeMetricPreviewHandler(config)))
+
+	// 查看当前生效的配置，需要 operator 或 admin 角色
+	mux.Handle(base+"/config", view(http.HandlerFunc(reloader.configHandler)))
+	mux.Handle(v1+"/config", view(http.HandlerFunc(reloader.configHandler)))
+
+	// 指标定义，查看需要 operator 或 admin 角色，修改保存在 overlay_file 中，需要 admin 角色
+	mux.Handle(base+"/metric-types", view(http.HandlerFunc(reloader.metricTypesHandler)))
+	mux.Handle(base+"/metric-types/", view(reloader.makeMetricTypeHandler(base+"/metric-types/")))
+	mux.Handle(v1+"/metric-types", view(http.HandlerFunc(reloader.metricTypesHandler)))
+	mux.Handle(v1+"/metric-types/", view(reloader.makeMetricTypeHandler(v1+"/metric-types/")))
+	mux.Handle(base+"/config/overlay", view(http.HandlerFunc(reloader.overlayHandler)))
+	mux.Handle(v1+"/config/overlay", view(http.HandlerFunc(reloader.overlayHandler)))
+
+	// 重新加载配置，需要 admin 角色
+	mux.Handle(base+"/config/reload", view(http.HandlerFunc(reloader.reloadHandler)))
+	mux.Handle(v1+"/config/reload", view(http.HandlerFunc(reloader.reloadHandler)))
+
+	// PromAI 自身的运行指标，供 Prometheus 抓取
+	mux.Handle("/metrics", view(telemetry.Handler()))
+	return nil
 }
 
-// executeInspectionWithProgress 带进度更新的巡检执行
-func executeInspectionWithProgress(collector *metrics.Collector, config *config.Config, prometheusURL string, taskID string) (*report.ReportData, error) {
-	// 开始执行巡检
-	taskmanager.GlobalTaskManager.UpdateTaskProgress(taskID, 25, "收集系统资源数据")
+// 巡检固定步骤名称，指标收集步骤按 metric_types 动态生成
+const (
+	stepEvaluateThresholds = "评估阈值"
+	stepPrepareCharts      = "准备图表数据"
+	stepRenderReport       = "渲染巡检报告"
+)
 
-	// 收集指标数据
-	data, err := collector.CollectMetrics()
-	if err != nil {
-		taskmanager.GlobalTaskManager.FailStep(taskID, "收集系统资源数据", err.Error())
-		return nil, fmt.Errorf("collecting metrics: %w", err)
+// 各阶段开始时的任务进度，指标收集阶段占 0 到 taskmanager.CollectProgressWeight，由已完成指标数计算
+const (
+	progressEvaluateThresholds = taskmanager.CollectProgressWeight
+	progressPrepareCharts      = 85
+	progressRenderReport       = 90
+	progressSendNotifications  = 95
+)
+
+// collectStepName 指标类型对应的收集步骤名称
+func collectStepName(metricType string) string {
+	return "收集指标: " + metricType
+}
+
+// buildInspectionSteps 根据配置生成巡检任务的执行步骤，每个启用的通知渠道对应一个步骤
+func buildInspectionSteps(config *config.Config) []taskmanager.TaskStep {
+	steps := make([]taskmanager.TaskStep, 0, len(config.MetricTypes)+6)
+	for _, metricType := range config.MetricTypes {
+		steps = append(steps, taskmanager.TaskStep{
+			Name:        collectStepName(metricType.Type),
+			Status:      taskmanager.StatusPending,
+			Description: fmt.Sprintf("查询 %d 项指标", len(metricType.Metrics)),
+		})
+	}
+	steps = append(steps,
+		taskmanager.TaskStep{Name: stepEvaluateThresholds, Status: taskmanager.StatusPending, Description: "根据阈值配置计算指标状态"},
+		taskmanager.TaskStep{Name: stepPrepareCharts, Status: taskmanager.StatusPending, Description: "计算分组统计并生成图表数据"},
+		taskmanager.TaskStep{Name: stepRenderReport, Status: taskmanager.StatusPending, Description: "生成HTML格式巡检报告"},
+	)
+	for _, channel := range notificationChannels(context.Background(), config, "") {
+		steps = append(steps, taskmanager.TaskStep{Name: channel.Step, Status: taskmanager.StatusPending, Description: channel.Description})
 	}
-	taskmanager.GlobalTaskManager.CompleteStep(taskID, "收集系统资源数据")
-	taskmanager.GlobalTaskManager.UpdateTaskProgress(taskID, 50, "收集服务状态")
+	return steps
+}
+
+// executeInspectionWithProgress 带进度更新的巡检执行，按实际阶段记录任务步骤
+func executeInspectionWithProgress(ctx context.Context, collector *metrics.Collector, config *config.Config, prometheusURL string, taskID string) (*report.ReportData, string, error) {
+	tm := taskmanager.GlobalTaskManager
+	taskCtx := tm.TaskContext(taskID)
 
-	// 设置数据源信息
+	data := collector.NewReportData()
 	data.Datasource = prometheusURL
+	if task, exists := tm.GetTaskSnapshot(taskID); exists {
+		data.DatasourceName = reportDatasourceName(task.Options.Datasource)
+	}
+
+	// 按指标类型逐组收集，每完成一个指标上报一次真实进度
+	total := 0
+	for _, metricType := range config.MetricTypes {
+		total += len(metricType.Metrics)
+	}
+	done, failed := 0, 0
+	for _, metricType := range config.MetricTypes {
+		stepName := collectStepName(metricType.Type)
+		tm.UpdateTaskProgress(taskID, done*progressEvaluateThresholds/max(total, 1), stepName)
+
+		group, errs := collector.CollectGroup(taskCtx, metricType, func(metricName string, err error) {
+			done++
+			progress := taskmanager.MetricProgress{Type: metricType.Type, Name: metricName, Done: done, Total: total}
+			if err != nil {
+				progress.Error = err.Error()
+			}
+			tm.ReportMetricProgress(taskID, progress)
+		})
+		data.MetricGroups[metricType.Type] = group
+		failed += len(errs)
+
+		if err := taskCtx.Err(); err != nil {
+			tm.FailStep(taskID, stepName, "任务已取消")
+			return nil, "", fmt.Errorf("collecting metrics: %w", err)
+		}
+		if len(errs) > 0 && len(errs) == len(metricType.Metrics) {
+			tm.FailStep(taskID, stepName, fmt.Sprintf("%d 项指标全部查询失败", len(errs)))
+			continue
+		}
+		tm.CompleteStep(taskID, stepName)
+	}
+	if total > 0 && failed == total {
+		return nil, "", fmt.Errorf("collecting metrics: all %d queries failed against %s", total, prometheusURL)
+	}
 
-	taskmanager.GlobalTaskManager.CompleteStep(taskID, "收集服务状态")
-	taskmanager.GlobalTaskManager.UpdateTaskProgress(taskID, 75, "分析告警信息")
+	// 评估阈值
+	tm.UpdateTaskProgress(taskID, progressEvaluateThresholds, stepEvaluateThresholds)
+	collector.EvaluateThresholds(data)
+	tm.CompleteStep(taskID, stepEvaluateThresholds)
 
-	// 分析告警信息
-	taskmanager.GlobalTaskManager.CompleteStep(taskID, "分析告警信息")
-	taskmanager.GlobalTaskManager.UpdateTaskProgress(taskID, 90, "生成巡检报告")
+	// 准备图表数据
+	tm.UpdateTaskProgress(taskID, progressPrepareCharts, stepPrepareCharts)
+	report.PrepareReportData(data)
+	tm.CompleteStep(taskID, stepPrepareCharts)
 
-	// 生成报告
-	reportFilePath, err := report.GenerateReport(*data)
+	// 渲染报告
+	tm.UpdateTaskProgress(taskID, progressRenderReport, stepRenderReport)
+	reportFilePath, err := report.RenderReport(*data)
 	if err != nil {
-		taskmanager.GlobalTaskManager.FailStep(taskID, "生成巡检报告", err.Error())
-		return nil, fmt.Errorf("generating report: %w", err)
+		tm.FailStep(taskID, stepRenderReport, err.Error())
+		return nil, "", fmt.Errorf("generating report: %w", err)
 	}
+	tm.CompleteStep(taskID, stepRenderReport)
+
+	// 发送通知，附带报告数据用于分类汇总；通知失败不影响报告，任务以 completed_with_warnings 结束
+	ctx = context.WithValue(ctx, "report_data", *data)
+	dispatchNotifications(ctx, config, reportFilePath, data, taskID)
 
 	// 完成任务
-	taskmanager.GlobalTaskManager.CompleteTask(taskID, reportFilePath)
+	tm.CompleteTask(taskID, reportFilePath)
+
+	return data, reportFilePath, nil
+}
+
+// resolveDatasource 将datasource参数（数据源名称或URL）解析为Prometheus地址，为空时使用默认地址
+func resolveDatasource(config *config.Config, datasource string) (string, error) {
+	if datasource == "" {
+		return config.PrometheusURL, nil
+	}
+	if isDatasourceURL(datasource) {
+		if err := datasourcePolicy.Load().Check(datasource); err != nil {
+			return "", err
+		}
+		return datasource, nil
+	}
+	// 查找配置的数据源
+	for _, ds := range config.DataSources {
+		if ds.Name == datasource {
+			return ds.URL, nil
+		}
+	}
+	return "", fmt.Errorf("datasource '%s' not found", datasource)
+}
+
+// newDatasourceClient 为请求指定的数据源创建Prometheus客户端，配置的数据源使用其认证配置，自定义URL的连接受数据源URL策略限制
+func newDatasourceClient(config *config.Config, datasource, prometheusURL string) (*prometheus.Client, error) {
+	if isDatasourceURL(datasource) {
+		return datasourcePolicy.Load().NewClient(prometheusURL)
+	}
+	for _, ds := range config.DataSources {
+		if ds.Name == datasource {
+			return prometheus.NewClientWithAuth(prometheusURL, ds.Auth)
+		}
+	}
+	return prometheus.NewClientWithAuth(prometheusURL, config.PrometheusAuth)
+}
+
+// datasourceClient 解析 datasource 参数并创建对应的 Prometheus 客户端
+func datasourceClient(config *config.Config, datasource string) (*prometheus.Client, error) {
+	prometheusURL, err := resolveDatasource(config, datasource)
+	if err != nil {
+		return nil, err
+	}
+	return newDatasourceClient(config, datasource, prometheusURL)
+}
+
+// writeDatasourceError 返回数据源解析错误：被URL策略拦截时记录审计日志并返回 403，否则返回 400
+func writeDatasourceError(w http.ResponseWriter, r *http.Request, datasource string, err error) {
+	if !errors.Is(err, prometheus.ErrURLBlocked) {
+		api.WriteError(w, r, http.StatusBadRequest, api.CodeDatasourceNotFound,
+			fmt.Sprintf("Datasource '%s' not found", datasource), map[string]string{"datasource": datasource})
+		return
+	}
+
+	user := "anonymous"
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		user = identity.Name
+	}
+	target := datasource
+	if u, parseErr := url.Parse(datasource); parseErr == nil {
+		target = u.Redacted()
+	}
+	slog.Warn("拦截自定义数据源URL", "audit", true, logging.KeyDatasource, target, logging.KeyUser, user,
+		logging.KeyRemote, r.RemoteAddr, logging.KeyPath, r.URL.Path, "policy", datasourcePolicy.Load().Mode(), logging.Err(err))
+	api.WriteError(w, r, http.StatusForbidden, api.CodeDatasourceBlocked, "Forbidden: "+err.Error(),
+		map[string]string{"datasource": target, "policy": datasourcePolicy.Load().Mode()})
+}
+
+// isDatasourceURL 判断 datasource 参数是否为自定义URL（包含http://或https://）而非配置的数据源名称
+func isDatasourceURL(datasource string) bool {
+	return strings.HasPrefix(datasource, "http://") || strings.HasPrefix(datasource, "https://")
+}
+
+// authorizeDatasource 检查请求方能否使用数据源发起查询：自定义URL需要 custom_datasource 权限，
+// 且数据源需在请求方的数据源范围内；无权限时返回 403
+func authorizeDatasource(w http.ResponseWriter, r *http.Request, datasource string) bool {
+	if isDatasourceURL(datasource) && !auth.Allowed(r, auth.PermCustomDatasource) {
+		auth.Forbid(w, r, "custom datasource URL requires admin role")
+		return false
+	}
+	if !auth.AllowedDatasource(r, datasource) {
+		if datasource == "" {
+			datasource = auth.DefaultDatasource
+		}
+		auth.Forbid(w, r, fmt.Sprintf("datasource '%s' is outside your scope", datasource))
+		return false
+	}
+	return true
+}
+
+// taskDatasourceName 返回任务在数据源权限范围中使用的名称，默认数据源返回空字符串
+func taskDatasourceName(task *taskmanager.InspectionTask) string {
+	if task.Options.Datasource != "" {
+		return task.Options.Datasource
+	}
+	// 通过任务API创建、尚未开始执行的任务记录的是数据源名称
+	if task.Status == taskmanager.StatusPending && !isDatasourceURL(task.Datasource) {
+		return task.Datasource
+	}
+	return ""
+}
+
+// datasourceLabel 返回监控指标中的数据源标签，自定义URL统一记为 custom，避免标签基数过高和泄露地址
+func datasourceLabel(datasource string) string {
+	switch {
+	case datasource == "":
+		return auth.DefaultDatasource
+	case isDatasourceURL(datasource):
+		return "custom"
+	default:
+		return datasource
+	}
+}
+
+// reportDatasourceName 返回写入报告的数据源名称，默认数据源记为 default，自定义URL隐藏其中的密码
+func reportDatasourceName(datasource string) string {
+	switch {
+	case datasource == "":
+		return auth.DefaultDatasource
+	case isDatasourceURL(datasource):
+		return redact.String(datasource)
+	default:
+		return datasource
+	}
+}
+
+// taskVisibleTo 返回判断任务是否在请求方数据源范围内的函数
+func taskVisibleTo(r *http.Request) func(*taskmanager.InspectionTask) bool {
+	return func(task *taskmanager.InspectionTask) bool {
+		return auth.AllowedDatasource(r, taskDatasourceName(task))
+	}
+}
+
+// splitParam 解析逗号分隔的查询参数
+func splitParam(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runInspection 按任务保存的执行参数运行巡检，返回报告文件路径
+func runInspection(ctx context.Context, collector *metrics.Collector, config *config.Config, taskID string) (string, error) {
+	task, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID)
+	if !exists {
+		return "", fmt.Errorf("task %s not found", taskID)
+	}
+	opts := task.Options
+
+	// 服务关闭过程中不再开始新的巡检，已开始的巡检（含通知发送）在宽限期内等待完成
+	done, err := taskmanager.GlobalTaskManager.Begin()
+	if err != nil {
+		taskmanager.GlobalTaskManager.FailTask(taskID, "服务正在关闭，巡检未执行")
+		return "", err
+	}
+	defer done()
+
+	start := time.Now()
+	defer func() {
+		status := taskmanager.StatusFailed
+		if task, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID); exists && task.Status.Finished() {
+			status = task.Status
+		}
+		telemetry.ObserveInspection(datasourceLabel(opts.Datasource), string(status), time.Since(start))
+	}()
+
+	reportFilePath, err := func() (string, error) {
+		prometheusURL, err := resolveDatasource(config, opts.Datasource)
+		if err != nil {
+			return "", err
+		}
+		inspectionConfig := config.Select(opts.MetricTypes, opts.Tags)
+
+		// 如果指定了datasource参数，创建新的collector
+		dataCollector := metrics.NewCollectorWithURL(collector.Client, inspectionConfig, prometheusURL)
+		if opts.Datasource != "" {
+			slog.Debug("创建自定义Prometheus客户端", logging.KeyTaskID, taskID, logging.KeyDatasource, prometheusURL)
+			client, err := newDatasourceClient(config, opts.Datasource, prometheusURL)
+			if err != nil {
+				return "", fmt.Errorf("creating prometheus client for datasource '%s': %w", opts.Datasource, err)
+			}
+			dataCollector = metrics.NewCollectorWithURL(client.API, inspectionConfig, prometheusURL)
+		}
+
+		slog.Info("开始执行巡检", logging.KeyTaskID, taskID, logging.KeyDatasource, prometheusURL)
+		_, reportFilePath, err := executeInspectionWithProgress(ctx, dataCollector, inspectionConfig, prometheusURL, taskID)
+		return reportFilePath, err
+	}()
+
+	if err != nil {
+		if task, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID); exists && !task.Status.Finished() {
+			taskmanager.GlobalTaskManager.FailTask(taskID, err.Error())
+		}
+		return "", err
+	}
+	return reportFilePath, nil
+}
+
+// runScheduledInspection 执行定时巡检，失败时按 schedule_retry 策略自动重试
+func runScheduledInspection(collector *metrics.Collector, config *config.Config) {
+	opts := taskmanager.TaskOptions{Tags: config.ScheduleTags}
+	steps := buildInspectionSteps(config.Select(nil, opts.Tags))
+	task := taskmanager.GlobalTaskManager.CreateTask("定时巡检", config.PrometheusURL, steps)
+	taskmanager.GlobalTaskManager.PrepareTask(task.ID, opts, steps)
+	slog.Info("开始执行定时巡检任务", logging.KeyTaskID, task.ID, "tags", strings.Join(opts.Tags, ","))
+
+	reportFilePath, err := runInspection(context.Background(), collector, config, task.ID)
+	for attempt := 1; err != nil && attempt <= config.ScheduleRetry.MaxAttempts; attempt++ {
+		interval := time.Duration(config.ScheduleRetry.Interval) * time.Second
+		slog.Warn("定时巡检任务失败，稍后重试", logging.KeyTaskID, task.ID, logging.Err(err), "retry_in", interval, "attempt", attempt)
+		select {
+		case <-time.After(interval):
+		case <-taskmanager.GlobalTaskManager.Draining():
+			slog.Warn("服务正在关闭，放弃重试定时巡检", logging.KeyTaskID, task.ID)
+			telemetry.ObserveSchedule(telemetry.ScheduleInspection, false)
+			return
+		}
+
+		retryTask, retryErr := taskmanager.GlobalTaskManager.CreateRetryTask(task.ID, steps)
+		if retryErr != nil {
+			slog.Error("创建重试任务失败", logging.KeyTaskID, task.ID, logging.Err(retryErr))
+			telemetry.ObserveSchedule(telemetry.ScheduleInspection, false)
+			return
+		}
+		task = retryTask
+		reportFilePath, err = runInspection(context.Background(), collector, config, task.ID)
+	}
+
+	telemetry.ObserveSchedule(telemetry.ScheduleInspection, err == nil)
+	if err != nil {
+		slog.Error("定时巡检任务失败", logging.KeyTaskID, task.ID, logging.Err(err))
+		return
+	}
+	slog.Info("定时巡检任务完成", logging.KeyTaskID, task.ID, "report", reportFilePath)
+}
 
-	return data, nil
+// reportResult getreport 对API客户端返回的巡检结果
+type reportResult struct {
+	TaskID     string                 `json:"taskId"`
+	Status     taskmanager.TaskStatus `json:"status"`
+	ReportFile string                 `json:"reportFile"`
+	ReportURL  string                 `json:"reportUrl"`
 }
 
 // makeReportHandler 创建报告处理器
 func makeReportHandler(collector *metrics.Collector, config *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 记录访问日志
-		log.Printf("[API] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		log.Printf("[DEBUG] 完整URL: %s", r.URL.String())
-		log.Printf("[DEBUG] 完整Query: %s", r.URL.Query())
-		// 获取并记录机器人key参数
+		logRequest(r)
+		slog.Debug("报告请求参数", "query", r.URL.RawQuery)
+		// 获取机器人key参数
 		wechatBotKey := r.URL.Query().Get("wechat_bot_key")
-		if wechatBotKey != "" {
-			log.Printf("[DEBUG] 获取到企业微信机器人key: %s", wechatBotKey)
-		} else {
-			log.Printf("[DEBUG] 未传入企业微信机器人key参数,使用默认值")
-		}
 
 		// 获取datasource参数 - 使用多种方法确保获取到正确的值
 		datasource := r.URL.Query().Get("datasource")
-		prometheusURL := ""
-
-		// 额外的调试信息
-		log.Printf("[DEBUG] 收到的完整查询参数RawQuery: %s", r.URL.RawQuery)
-		log.Printf("[DEBUG] 收到的URL.Query()结果: %v", r.URL.Query())
-		log.Printf("[DEBUG] 收到的datasource参数: '%s'", datasource)
-		log.Printf("[DEBUG] 收到的wechat_bot_key参数: '%s'", r.URL.Query().Get("wechat_bot_key"))
 
 		// 确保datasource在任何位置都能被识别
 		if datasource == "" && r.URL.RawQuery != "" {
 			// 手动解析查询字符串，防止URL.Query()出现问题
-			queryParams := strings.Split(r.URL.RawQuery, "&")
-			log.Printf("[DEBUG] 手动解析的查询参数:")
-			for _, param := range queryParams {
-				log.Printf("[DEBUG]   %s", param)
+			for _, param := range strings.Split(r.URL.RawQuery, "&") {
 				if strings.HasPrefix(param, "datasource=") {
 					// 提取datasource值
 					if parts := strings.SplitN(param, "=", 2); len(parts) == 2 {
 						datasource = parts[1]
-						log.Printf("[DEBUG] 手动解析找到datasource: '%s'", datasource)
+						slog.Debug("手动解析找到datasource", logging.KeyDatasource, datasource)
 						break
 					}
 				}
 			}
 		}
 
-		if datasource != "" {
-			log.Printf("[DEBUG] datasource参数不为空，开始处理...")
-			// 检查是否是URL格式（包含http://或https://）
-			if strings.HasPrefix(datasource, "http://") || strings.HasPrefix(datasource, "https://") {
-				prometheusURL = datasource
-				log.Printf("[DEBUG] 检测到URL格式，使用自定义PrometheusURL: %s", prometheusURL)
-			} else {
-				log.Printf("[DEBUG] 检测到名称格式，查找配置的数据源...")
-				// 查找配置的数据源
-				for _, ds := range config.DataSources {
-					log.Printf("[DEBUG] 检查数据源: %s -> %s", ds.Name, ds.URL)
-					if ds.Name == datasource {
-						prometheusURL = ds.URL
-						log.Printf("[DEBUG] 找到匹配的数据源: %s -> %s", ds.Name, ds.URL)
-						break
-					}
-				}
-				if prometheusURL == "" {
-					log.Printf("[DEBUG] 未找到配置的数据源: %s", datasource)
-					http.Error(w, fmt.Sprintf("Datasource '%s' not found", datasource), http.StatusBadRequest)
-					return
-				}
-			}
-		} else {
-			// 使用默认的Prometheus URL
-			prometheusURL = config.PrometheusURL
-			log.Printf("[DEBUG] datasource参数为空，使用默认Prometheus URL: %s", prometheusURL)
+		if !auth.Allowed(r, auth.PermInspect) {
+			auth.Forbid(w, r, "triggering inspections requires operator role")
+			return
+		}
+		if !authorizeDatasource(w, r, datasource) {
+			return
+		}
+
+		prometheusURL, err := resolveDatasource(config, datasource)
+		if err != nil {
+			slog.Warn("数据源不可用", logging.KeyDatasource, datasource, logging.Err(err))
+			writeDatasourceError(w, r, datasource, err)
+			return
+		}
+
+		opts := taskmanager.TaskOptions{
+			Datasource:   datasource,
+			MetricTypes:  splitParam(r.URL.Query().Get("types")),
+			Tags:         splitParam(r.URL.Query().Get("tags")),
+			WeChatBotKey: wechatBotKey,
+		}
+		selected := config.Select(opts.MetricTypes, opts.Tags)
+		if len(selected.MetricTypes) == 0 {
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "No enabled metrics match the requested types and tags",
+				map[string]interface{}{"types": opts.MetricTypes, "tags": opts.Tags})
+			return
 		}
-		log.Printf("[DEBUG] 最终使用的Prometheus URL: %s", prometheusURL)
+		steps := buildInspectionSteps(selected)
 
 		// 获取taskID参数（可选）
 		taskID := r.URL.Query().Get("taskid")
 
 		// 如果没有提供taskID，自动生成一个（确保所有逻辑都使用带进度更新的执行方式）
 		if taskID == "" {
-			log.Printf("[DEBUG] 未传入taskid，自动生成taskid")
 			// 使用任务管理器创建任务来生成唯一的taskid
-			defaultTask := taskmanager.GlobalTaskManager.CreateTask("手动巡检", prometheusURL)
+			defaultTask := taskmanager.GlobalTaskManager.CreateTask("手动巡检", prometheusURL, steps)
 			taskID = defaultTask.ID
-			log.Printf("[DEBUG] 自动生成的taskid: %s", taskID)
+			slog.Debug("未传入taskid，自动生成taskid", logging.KeyTaskID, taskID)
 		}
 
-		// 如果指定了datasource参数，创建新的collector
-		var dataCollector *metrics.Collector
-		if datasource != "" {
-			// 创建新的Prometheus客户端
-			log.Printf("[DEBUG] 创建自定义Prometheus客户端，URL: %s", prometheusURL)
-			client, err := prometheus.NewClient(prometheusURL)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to create Prometheus client for datasource '%s': %v", datasource, err), http.StatusInternalServerError)
-				return
-			}
-			dataCollector = metrics.NewCollectorWithURL(client.API, config, prometheusURL)
-			log.Printf("[DEBUG] 自定义collector创建完成，数据源: %s", prometheusURL)
-		} else {
-			dataCollector = collector
-			log.Printf("[DEBUG] 使用全局collector")
+		// 保存执行参数，用于失败后重试
+		if !taskmanager.GlobalTaskManager.PrepareTask(taskID, opts, steps) {
+			api.WriteError(w, r, http.StatusConflict, api.CodeConflict,
+				fmt.Sprintf("Task '%s' not found or already started", taskID), map[string]string{"taskId": taskID})
+			return
 		}
 
-		var data *report.ReportData
-		var err error
+		// 创建包含HTTP请求的context，用于通知中的动态URL生成
+		ctx := context.WithValue(r.Context(), "http_request", r)
 
-		// 现在总是使用带进度更新的执行方式（自动生成的taskid或传入的taskid）
-		log.Printf("[DEBUG] 开始执行巡检，taskid: %s, datasource: %s", taskID, prometheusURL)
-		data, err = executeInspectionWithProgress(dataCollector, config, prometheusURL, taskID)
-		if err != nil {
-			http.Error(w, "Failed to collect metrics", http.StatusInternalServerError)
-			log.Printf("Error collecting metrics: %v", err)
+		// 现在总是使用带进度更新的执行方式（自动生成的taskid或传入的taskid），手动触发时也发送通知
+		reportFilePath, err := runInspection(ctx, collector, config, taskID)
+		if errors.Is(err, taskmanager.ErrShuttingDown) {
+			api.WriteError(w, r, http.StatusServiceUnavailable, api.CodeShuttingDown, "Server is shutting down", nil)
 			return
 		}
-
-		reportFilePath, err := report.GenerateReport(*data)
 		if err != nil {
-			http.Error(w, "Failed to generate report", http.StatusInternalServerError)
-			log.Printf("Error generating report: %v", err)
+			api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, "Failed to generate report",
+				map[string]string{"taskId": taskID})
+			slog.Error("生成报告失败", logging.KeyTaskID, taskID, logging.KeyDatasource, datasource, logging.Err(err))
 			return
 		}
 
-		// 创建包含HTTP请求和报告数据的context，用于动态URL生成和分类汇总
-		ctx := context.WithValue(r.Context(), "http_request", r)
-		ctx = context.WithValue(ctx, "report_data", *data)
-
-		// 手动触发时也发送通知
-		sendNotificationsWithContext(ctx, config, reportFilePath, data)
-
-		// 如果是自动生成的taskid，可以可选地清理任务记录（可选）
-		if strings.HasPrefix(taskID, "manual_") {
-			log.Printf("[DEBUG] 清理自动生成的任务记录: %s", taskID)
-			// taskmanager.GlobalTaskManager.RemoveTask(taskID) // 可选：移除任务记录
-		}
-
 		// 去掉 reports/ 前缀，因为静态文件服务已经映射到 reports 目录
 		reportFileName := strings.TrimPrefix(reportFilePath, "reports/")
-		http.Redirect(w, r, "/api/promai/reports/"+reportFileName, http.StatusSeeOther)
+
+		// API客户端（Accept 优先 application/json）返回报告信息，浏览器重定向到报告页面
+		if api.WantsJSON(r) {
+			result := reportResult{TaskID: taskID, ReportFile: reportFileName, ReportURL: utils.ReportLink(r, "", reportFileName)}
+			if task, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID); exists {
+				result.Status = task.Status
+			}
+			api.WriteJSON(w, http.StatusOK, result)
+			return
+		}
+		http.Redirect(w, r, utils.GetBasePath()+"/reports/"+reportFileName, http.StatusSeeOther)
 	}
 }
 
-// sendNotifications 发送所有通知（兼容版本）
-func sendNotifications(config *config.Config, reportFilePath string, reportData *report.ReportData) {
-	sendNotificationsWithContext(context.Background(), config, reportFilePath, reportData)
-}
+// 通知渠道对应的任务步骤名称
+const (
+	stepNotifyDingtalk   = "发送钉钉通知"
+	stepNotifyEmail      = "发送邮件通知"
+	stepNotifyWeChatWork = "发送企业微信通知"
+	stepNotifyWeChatBot  = "发送企业微信机器人通知"
+)
 
-// sendNotificationsWithContext 发送所有通知（支持动态URL）
-func sendNotificationsWithContext(ctx context.Context, config *config.Config, reportFilePath string, reportData *report.ReportData) {
-	// 计算告警汇总
-	alertSummary := notify.CalculateAlertSummary(*reportData)
+// 通知渠道名称，用于日志中的 channel 属性
+const (
+	notifyChannelDingtalk   = "dingtalk"
+	notifyChannelEmail      = "email"
+	notifyChannelWeChatWork = "wechat_work"
+	notifyChannelWeChatBot  = "wechat_bot"
+)
+
+// notificationChannel 单个通知渠道，Step 同时作为任务步骤名称
+type notificationChannel struct {
+	Name        string
+	Step        string
+	Description string
+	Send        func(reportFilePath string, reportData *report.ReportData, alertSummary notify.AlertSummary) error
+}
 
-	log.Printf("告警汇总: 总指标=%d, 异常=%d, 严重=%d, 警告=%d, 正常=%d",
-		alertSummary.TotalMetrics, alertSummary.TotalAlerts, alertSummary.CriticalAlerts,
-		alertSummary.WarningAlerts, alertSummary.NormalMetrics)
+// notificationChannels 根据配置和请求指定的企业微信机器人key生成需要发送的通知渠道
+func notificationChannels(ctx context.Context, config *config.Config, wechatBotKey string) []notificationChannel {
+	var channels []notificationChannel
 
 	if config.Notifications.Dingtalk.Enabled {
-		log.Printf("发送钉钉消息")
-		if err := notify.SendDingtalkWithContext(ctx, config.Notifications.Dingtalk, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary); err != nil {
-			log.Printf("发送钉钉消息失败: %v", err)
-		}
+		channels = append(channels, notificationChannel{
+			Name:        notifyChannelDingtalk,
+			Step:        stepNotifyDingtalk,
+			Description: "发送钉钉机器人消息",
+			Send: func(reportFilePath string, reportData *report.ReportData, alertSummary notify.AlertSummary) error {
+				return notify.SendDingtalkWithContext(ctx, config.Notifications.Dingtalk, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary)
+			},
+		})
 	}
 
 	if config.Notifications.Email.Enabled {
-		log.Printf("发送邮件")
-		notify.SendEmailWithContext(ctx, config.Notifications.Email, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary)
+		channels = append(channels, notificationChannel{
+			Name:        notifyChannelEmail,
+			Step:        stepNotifyEmail,
+			Description: "发送巡检报告邮件",
+			Send: func(reportFilePath string, reportData *report.ReportData, alertSummary notify.AlertSummary) error {
+				return notify.SendEmailWithContext(ctx, config.Notifications.Email, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary)
+			},
+		})
 	}
 
 	if config.Notifications.WeChatWork.Enabled {
-		log.Printf("发送企业微信消息")
-		if err := notify.SendWeChatWorkWithContext(ctx, config.Notifications.WeChatWork, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary); err != nil {
-			log.Printf("发送企业微信消息失败: %v", err)
-		}
+		channels = append(channels, notificationChannel{
+			Name:        notifyChannelWeChatWork,
+			Step:        stepNotifyWeChatWork,
+			Description: "发送企业微信机器人消息",
+			Send: func(reportFilePath string, reportData *report.ReportData, alertSummary notify.AlertSummary) error {
+				return notify.SendWeChatWorkWithContext(ctx, config.Notifications.WeChatWork, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary)
+			},
+		})
 	}
 
 	// 检查是否有动态传入的企业微信机器人key
-	if r, ok := ctx.Value("http_request").(*http.Request); ok {
-		wechatBotKey := r.URL.Query().Get("wechat_bot_key")
-		if wechatBotKey != "" {
-			log.Printf("[NOTIFICATION] 检测到动态企业微信机器人key: %s", wechatBotKey)
-			log.Printf("[NOTIFICATION] 开始发送企业微信通知...")
+	if wechatBotKey != "" {
+		slog.Debug("检测到动态企业微信机器人key", logging.KeyChannel, notifyChannelWeChatBot, "bot_key", redact.Secret(wechatBotKey))
+		// 从配置文件获取代理地址
+		proxyURL := config.Notifications.WeChatWork.ProxyURL
+		channels = append(channels, notificationChannel{
+			Name:        notifyChannelWeChatBot,
+			Step:        stepNotifyWeChatBot,
+			Description: "发送到请求指定的企业微信机器人",
+			Send: func(reportFilePath string, reportData *report.ReportData, alertSummary notify.AlertSummary) error {
+				return notify.SendWeChatWorkWithWebhook(ctx, wechatBotKey, proxyURL, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary)
+			},
+		})
+	}
 
-			// 从配置文件获取代理地址
-			proxyURL := ""
-			if config.Notifications.WeChatWork.ProxyURL != "" {
-				proxyURL = config.Notifications.WeChatWork.ProxyURL
-			}
-			log.Printf("[NOTIFICATION] 使用代理地址: %s", proxyURL)
+	return channels
+}
 
-			if err := notify.SendWeChatWorkWithWebhook(ctx, wechatBotKey, proxyURL, reportFilePath, config.ProjectName, reportData.Datasource, alertSummary); err != nil {
-				log.Printf("[NOTIFICATION] 发送企业微信消息失败: %v", err)
-			} else {
-				log.Printf("[NOTIFICATION] 企业微信通知发送成功")
-			}
-		} else {
-			log.Printf("[NOTIFICATION] 未传入企业微信机器人key，跳过企业微信通知")
+// logAlertSummary 打印告警汇总并返回
+func logAlertSummary(reportData *report.ReportData) notify.AlertSummary {
+	alertSummary := notify.CalculateAlertSummary(*reportData)
+
+	slog.Info("告警汇总", logging.KeyDatasource, reportData.Datasource,
+		"total", alertSummary.TotalMetrics, "alerts", alertSummary.TotalAlerts, "critical", alertSummary.CriticalAlerts,
+		"warning", alertSummary.WarningAlerts, "normal", alertSummary.NormalMetrics)
+
+	return alertSummary
+}
+
+// dispatchNotifications 逐个渠道发送通知，并将每个渠道的结果记录为任务步骤
+func dispatchNotifications(ctx context.Context, config *config.Config, reportFilePath string, reportData *report.ReportData, taskID string) {
+	tm := taskmanager.GlobalTaskManager
+	alertSummary := logAlertSummary(reportData)
+
+	var wechatBotKey string
+	if task, exists := tm.GetTaskSnapshot(taskID); exists {
+		wechatBotKey = task.Options.WeChatBotKey
+	}
+
+	for _, channel := range notificationChannels(ctx, config, wechatBotKey) {
+		// 动态渠道（如请求指定的机器人key）不在创建任务时的步骤列表中
+		tm.AddStep(taskID, taskmanager.TaskStep{Name: channel.Step, Status: taskmanager.StatusPending, Description: channel.Description})
+		tm.UpdateTaskProgress(taskID, progressSendNotifications, channel.Step)
+
+		err := channel.Send(reportFilePath, reportData, alertSummary)
+		telemetry.ObserveNotification(channel.Name, err)
+		if err != nil {
+			slog.Error("发送通知失败", logging.KeyTaskID, taskID, logging.KeyChannel, channel.Name, logging.Err(err))
+			tm.FailStep(taskID, channel.Step, err.Error())
+			continue
 		}
+		tm.CompleteStep(taskID, channel.Step)
 	}
 }
 
 // makeStatusHandler 创建状态页面处理器
 func makeStatusHandler(client metrics.PrometheusAPI, config *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// 记录访问日志
-		log.Printf("[API] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		logRequest(r)
 
 		// 获取datasource参数
 		datasource := r.URL.Query().Get("datasource")
-		prometheusURL := ""
-		var prometheusClient metrics.PrometheusAPI
+		if !authorizeDatasource(w, r, datasource) {
+			return
+		}
+		prometheusURL, err := resolveDatasource(config, datasource)
+		if err != nil {
+			writeDatasourceError(w, r, datasource, err)
+			return
+		}
 
+		var prometheusClient metrics.PrometheusAPI
 		if datasource != "" {
-			// 检查是否是URL格式（包含http://或https://）
-			if strings.HasPrefix(datasource, "http://") || strings.HasPrefix(datasource, "https://") {
-				prometheusURL = datasource
-			} else {
-				// 查找配置的数据源
-				for _, ds := range config.DataSources {
-					if ds.Name == datasource {
-						prometheusURL = ds.URL
-						break
-					}
-				}
-				if prometheusURL == "" {
-					http.Error(w, fmt.Sprintf("Datasource '%s' not found", datasource), http.StatusBadRequest)
-					return
-				}
-			}
-
 			// 创建新的Prometheus客户端
-			newClient, err := prometheus.NewClient(prometheusURL)
+			newClient, err := newDatasourceClient(config, datasource, prometheusURL)
 			if err != nil {
 				http.Error(w, fmt.Sprintf("Failed to create Prometheus client for datasource '%s': %v", datasource, err), http.StatusInternalServerError)
 				return
@@ -502,53 +2140,55 @@ func makeStatusHandler(client metrics.PrometheusAPI, config *config.Config) http
 			prometheusClient = newClient.API
 		} else {
 			prometheusClient = client
-			prometheusURL = config.PrometheusURL
 		}
 
-		log.Printf("状态接口使用Prometheus URL: %s", prometheusURL)
-		data, err := status.CollectMetricStatus(prometheusClient, config, prometheusURL)
+		slog.Debug("状态接口使用Prometheus URL", logging.KeyDatasource, prometheusURL)
+		// 停用的指标不显示在状态页
+		data, err := status.CollectMetricStatus(prometheusClient, config.Select(nil, nil), prometheusURL)
 		if err != nil {
 			http.Error(w, "Failed to collect status data", http.StatusInternalServerError)
-			log.Printf("Error collecting status data: %v", err)
+			slog.Error("收集状态数据失败", logging.KeyDatasource, prometheusURL, logging.Err(err))
 			return
 		}
 
-		// 创建模板函数映射
-		funcMap := template.FuncMap{
-			"now": time.Now,
-			"date": func(format string, t time.Time) string {
-				return t.Format(format)
-			},
-		}
-
-		tmpl := template.New("status.html").Funcs(funcMap)
+		tmpl := template.New("status.html").Funcs(statusTemplateFuncs)
 		tmpl, err = tmpl.ParseFiles("templates/status.html")
 		if err != nil {
 			http.Error(w, "Failed to parse template", http.StatusInternalServerError)
-			log.Printf("Error parsing template: %v", err)
+			slog.Error("解析模板失败", "template", "status.html", logging.Err(err))
 			return
 		}
 
 		if err := tmpl.Execute(w, data); err != nil {
 			http.Error(w, "Failed to render template", http.StatusInternalServerError)
-			log.Printf("Error rendering template: %v", err)
+			slog.Error("渲染模板失败", "template", "status.html", logging.Err(err))
 			return
 		}
 	}
 }
 
+// pageData 页面模板数据
+type pageData struct {
+	BasePath string // 路由前缀，页面中的链接和接口请求以此为前缀
+}
+
+// newPageData 创建页面模板数据
+func newPageData() pageData {
+	return pageData{BasePath: utils.GetBasePath()}
+}
+
 // indexHandler 首页处理器
 func indexHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := template.ParseFiles("templates/index.html")
 	if err != nil {
 		http.Error(w, "Failed to parse template", http.StatusInternalServerError)
-		log.Printf("Error parsing index template: %v", err)
+		slog.Error("解析模板失败", "template", "index.html", logging.Err(err))
 		return
 	}
 
-	if err := tmpl.Execute(w, nil); err != nil {
+	if err := tmpl.Execute(w, newPageData()); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-		log.Printf("Error rendering index template: %v", err)
+		slog.Error("渲染模板失败", "template", "index.html", logging.Err(err))
 		return
 	}
 }
@@ -558,13 +2198,13 @@ func progressHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := template.ParseFiles("templates/progress.html")
 	if err != nil {
 		http.Error(w, "Failed to parse template", http.StatusInternalServerError)
-		log.Printf("Error parsing progress template: %v", err)
+		slog.Error("解析模板失败", "template", "progress.html", logging.Err(err))
 		return
 	}
 
-	if err := tmpl.Execute(w, nil); err != nil {
+	if err := tmpl.Execute(w, newPageData()); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-		log.Printf("Error rendering progress template: %v", err)
+		slog.Error("渲染模板失败", "template", "progress.html", logging.Err(err))
 		return
 	}
 }
@@ -574,32 +2214,29 @@ func reportsHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := template.ParseFiles("templates/reports.html")
 	if err != nil {
 		http.Error(w, "Failed to parse template", http.StatusInternalServerError)
-		log.Printf("Error parsing reports template: %v", err)
+		slog.Error("解析模板失败", "template", "reports.html", logging.Err(err))
 		return
 	}
 
-	if err := tmpl.Execute(w, nil); err != nil {
+	if err := tmpl.Execute(w, newPageData()); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-		log.Printf("Error rendering reports template: %v", err)
+		slog.Error("渲染模板失败", "template", "reports.html", logging.Err(err))
 		return
 	}
 }
 
 // reportsListHandler 报告列表API处理器
 func reportsListHandler(w http.ResponseWriter, r *http.Request) {
-	// 记录访问日志
-	log.Printf("[API] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	logRequest(r)
 
 	// 读取reports目录下的所有HTML文件
 	files, err := os.ReadDir("reports")
 	if err != nil {
-		log.Printf("Error reading reports directory: %v", err)
-		http.Error(w, "Failed to read reports directory", http.StatusInternalServerError)
+		slog.Error("读取报告目录失败", logging.Err(err))
+		api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, "Failed to read reports directory", nil)
 		return
 	}
 
-	log.Printf("Found %d files in reports directory", len(files))
-
 	type ReportInfo struct {
 		ID         string `json:"id"`
 		Title      string `json:"title"`
@@ -619,10 +2256,14 @@ func reportsListHandler(w http.ResponseWriter, r *http.Request) {
 
 	var reports []ReportInfo
 	htmlFileCount := 0
+	visible := reportVisibleTo(r)
 
 	for _, file := range files {
 		if !file.IsDir() && strings.HasSuffix(file.Name(), ".html") {
 			htmlFileCount++
+			if !visible(filepath.Join("reports", file.Name())) {
+				continue
+			}
 			info, err := file.Info()
 			if err != nil {
 				continue
@@ -688,10 +2329,10 @@ func reportsListHandler(w http.ResponseWriter, r *http.Request) {
 					}
 
 					// 从任务管理器获取任务信息以计算耗时
-					task, exists := taskmanager.GlobalTaskManager.GetTask(id)
+					task, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(id)
 					var startTime, endTime time.Time
 
-					if exists && task != nil {
+					if exists {
 						startTime = task.StartTime
 						endTime = task.EndTime
 					} else {
@@ -708,7 +2349,7 @@ func reportsListHandler(w http.ResponseWriter, r *http.Request) {
 						Title: fmt.Sprintf("系统巡检报告 - %s", datasource),
 						Time:  formattedTime,
 						Size:  formatFileSize(info.Size()),
-						URL:   "/api/promai/reports/" + name,
+						URL:   utils.GetBasePath() + "/reports/" + name,
 					}
 
 					// 计算实际耗时
@@ -736,7 +2377,7 @@ func reportsListHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	log.Printf("Processed %d HTML files, created %d report entries", htmlFileCount, len(reports))
+	slog.Debug("报告列表", "files", len(files), "html_files", htmlFileCount, "reports", len(reports))
 
 	// 按时间倒序排序
 	sort.Slice(reports, func(i, j int) bool {
@@ -745,8 +2386,60 @@ func reportsListHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(reports); err != nil {
-		log.Printf("Error encoding reports: %v", err)
+		slog.Error("编码报告列表失败", logging.Err(err))
+	}
+}
+
+// reportHeadSize 读取报告数据源标记时读取的文件头部长度，标记位于 <head> 开头
+const reportHeadSize = 4096
+
+// reportDatasourcePattern 匹配报告中记录的数据源名称
+var reportDatasourcePattern = regexp.MustCompile(`<meta name="promai-datasource" content="([^"]*)">`)
+
+// reportDatasource 读取报告记录的数据源名称，旧版本生成的报告没有记录时 ok 为 false
+func reportDatasource(path string) (name string, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
 	}
+	defer file.Close()
+	head := make([]byte, reportHeadSize)
+	n, _ := io.ReadFull(file, head)
+	matches := reportDatasourcePattern.FindSubmatch(head[:n])
+	if matches == nil {
+		return "", false
+	}
+	return html.UnescapeString(string(matches[1])), true
+}
+
+// reportVisibleTo 返回判断报告是否在请求方数据源范围内的函数，未记录数据源的报告只对不限数据源范围的请求方可见
+func reportVisibleTo(r *http.Request) func(path string) bool {
+	return func(path string) bool {
+		name, ok := reportDatasource(path)
+		if !ok {
+			return auth.AllowedAllDatasources(r)
+		}
+		return auth.AllowedDatasource(r, name)
+	}
+}
+
+// reportFileHandler 提供报告文件访问，数据源范围外的报告返回 403，目录列表只对不限数据源范围的请求方开放
+func reportFileHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if info, err := os.Stat(name); err == nil {
+			allowed := auth.AllowedAllDatasources(r)
+			if !info.IsDir() {
+				allowed = reportVisibleTo(r)(name)
+			}
+			if !allowed {
+				auth.Forbid(w, r, fmt.Sprintf("report '%s' is outside your datasource scope", r.URL.Path))
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
 }
 
 // formatFileSize 格式化文件大小
@@ -777,16 +2470,17 @@ type ActivityItem struct {
 
 // recentActivitiesHandler 处理最近活动API
 func recentActivitiesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[API] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	logRequest(r)
 
 	w.Header().Set("Content-Type", "application/json")
 
 	var activities []ActivityItem
 
 	// 获取最近的报告
+	visibleReport := reportVisibleTo(r)
 	if files, err := os.ReadDir("reports"); err == nil {
 		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(file.Name(), ".html") {
+			if !file.IsDir() && strings.HasSuffix(file.Name(), ".html") && visibleReport(filepath.Join("reports", file.Name())) {
 
 				// 只取最近5个报告
 				if len(activities) >= 5 {
@@ -841,14 +2535,29 @@ func recentActivitiesHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 获取最近的任务
 	tasks := taskmanager.GlobalTaskManager.GetAllTasks()
+	visible := taskVisibleTo(r)
 	for _, task := range tasks {
 		// 只取最近的任务
 		if len(activities) >= 10 {
 			break
 		}
+		if !visible(task) {
+			continue
+		}
 
 		// 根据任务状态生成活动
 		switch task.Status {
+		case taskmanager.StatusCompletedWithWarnings:
+			activities = append(activities, ActivityItem{
+				ID:         "task_" + task.ID,
+				Type:       "warning",
+				Title:      "巡检任务完成（有警告）",
+				Message:    fmt.Sprintf("%s 巡检任务已完成，部分步骤失败", task.Datasource),
+				Time:       task.EndTime,
+				Icon:       "!",
+				Source:     "task",
+				Datasource: task.Datasource,
+			})
 		case taskmanager.StatusCompleted:
 			activities = append(activities, ActivityItem{
 				ID:         "task_" + task.ID,
@@ -896,20 +2605,34 @@ func recentActivitiesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewEncoder(w).Encode(activities); err != nil {
-		log.Printf("Error encoding activities: %v", err)
+		slog.Error("编码最近活动失败", logging.Err(err))
+	}
+}
+
+// makeTasksHandler 创建任务列表API处理器
+func makeTasksHandler(config *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tasksHandler(w, r, config)
 	}
 }
 
 // tasksHandler 处理任务列表API
-func tasksHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[API] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+func tasksHandler(w http.ResponseWriter, r *http.Request, config *config.Config) {
+	logRequest(r)
 
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
 	case "GET":
-		// 获取所有任务
-		tasks := taskmanager.GlobalTaskManager.GetAllTasks()
+		// 按条件查询任务，满足条件的总数通过 X-Total-Count 返回
+		filter, err := parseTaskFilter(r)
+		if err != nil {
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		filter.Allow = taskVisibleTo(r)
+		tasks, total := taskmanager.GlobalTaskManager.ListTasks(filter)
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
 		json.NewEncoder(w).Encode(tasks)
 
 	case "POST":
@@ -920,53 +2643,367 @@ func tasksHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Invalid request body", err.Error())
+			return
+		}
+
+		if !auth.Allowed(r, auth.PermInspect) {
+			auth.Forbid(w, r, "creating tasks requires operator role")
+			return
+		}
+		if !authorizeDatasource(w, r, req.Datasource) {
+			return
+		}
+		if _, err := resolveDatasource(config, req.Datasource); err != nil {
+			writeDatasourceError(w, r, req.Datasource, err)
 			return
 		}
 
 		if req.Name == "" {
 			req.Name = "系统巡检任务"
 		}
+		if taskmanager.GlobalTaskManager.ShuttingDown() {
+			api.WriteError(w, r, http.StatusServiceUnavailable, api.CodeShuttingDown, "Server is shutting down", nil)
+			return
+		}
 
-		task := taskmanager.GlobalTaskManager.CreateTask(req.Name, req.Datasource)
+		task := taskmanager.GlobalTaskManager.CreateTask(req.Name, req.Datasource, buildInspectionSteps(config))
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(task)
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		api.MethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// parseTimeParam 解析RFC3339格式的时间参数，为空时返回零值
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected RFC3339 time, got %q", name, value)
+	}
+	return t, nil
+}
+
+// parseIntParam 解析非负整数参数，为空时返回0
+func parseIntParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: expected non-negative integer, got %q", name, value)
+	}
+	return n, nil
+}
+
+// parseTaskFilter 从查询参数解析任务过滤条件
+// 支持 status（逗号分隔）、datasource、name、since、until、limit、offset、sort（asc/desc）
+func parseTaskFilter(r *http.Request) (taskmanager.TaskFilter, error) {
+	query := r.URL.Query()
+	filter := taskmanager.TaskFilter{
+		Datasource: query.Get("datasource"),
+		Name:       query.Get("name"),
+	}
+	for _, status := range splitParam(query.Get("status")) {
+		filter.Statuses = append(filter.Statuses, taskmanager.TaskStatus(status))
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(r, "since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseTimeParam(r, "until"); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = parseIntParam(r, "limit"); err != nil {
+		return filter, err
+	}
+	if filter.Offset, err = parseIntParam(r, "offset"); err != nil {
+		return filter, err
+	}
+
+	switch query.Get("sort") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, fmt.Errorf("invalid sort: expected asc or desc, got %q", query.Get("sort"))
+	}
+	return filter, nil
+}
+
+// defaultStatsPeriod 任务统计默认的时间范围
+const defaultStatsPeriod = 24 * time.Hour
+
+// taskStatsHandler 返回时间段内按状态的任务数，以及每个数据源的平均和P95耗时
+// 时间段由 since/until（RFC3339）指定，或由 period（如 24h、168h）指定截至当前的时长
+func taskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	until, err := parseTimeParam(r, "until")
+	if err != nil {
+		api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	since, err := parseTimeParam(r, "since")
+	if err != nil {
+		api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if since.IsZero() {
+		period := defaultStatsPeriod
+		if value := r.URL.Query().Get("period"); value != "" {
+			if period, err = time.ParseDuration(value); err != nil || period <= 0 {
+				api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, fmt.Sprintf("invalid period: %q", value), nil)
+				return
+			}
+		}
+		since = until.Add(-period)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(taskmanager.GlobalTaskManager.Stats(taskmanager.TaskFilter{
+		Since: since,
+		Until: until,
+		Allow: taskVisibleTo(r),
+	}))
+}
+
+// makeTaskDetailHandler 创建单个任务详情API处理器，prefix 为任务ID之前的路由前缀
+func makeTaskDetailHandler(collector *metrics.Collector, config *config.Config, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskDetailHandler(w, r, collector, config, prefix)
 	}
 }
 
 // taskDetailHandler 处理单个任务详情API
-func taskDetailHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[API] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+func taskDetailHandler(w http.ResponseWriter, r *http.Request, collector *metrics.Collector, config *config.Config, prefix string) {
+	logRequest(r)
 
 	// 从路径中提取任务ID
-	path := strings.TrimPrefix(r.URL.Path, "/api/promai/tasks/")
+	path := strings.TrimPrefix(r.URL.Path, prefix)
 	parts := strings.Split(path, "/")
 	if len(parts) == 0 || parts[0] == "" {
-		http.Error(w, "Task ID required", http.StatusBadRequest)
+		api.WriteError(w, r, http.StatusBadRequest, api.CodeBadRequest, "Task ID required", nil)
 		return
 	}
 	taskID := parts[0]
 
+	// 任务统计
+	if taskID == "stats" {
+		if r.Method != "GET" {
+			api.MethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		taskStatsHandler(w, r)
+		return
+	}
+
+	// 任务数据源不在请求方权限范围内时拒绝访问
+	if task, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID); exists && !taskVisibleTo(r)(&task) {
+		auth.Forbid(w, r, fmt.Sprintf("task '%s' is outside your datasource scope", taskID))
+		return
+	}
+
+	// 任务事件流（SSE）
+	if len(parts) > 1 && parts[1] == "events" {
+		if r.Method != "GET" {
+			api.MethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		taskEventsHandler(w, r, taskID)
+		return
+	}
+
+	// 按原任务参数重试
+	if len(parts) > 1 && parts[1] == "retry" {
+		if r.Method != "POST" {
+			api.MethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		if !auth.Allowed(r, auth.PermInspect) {
+			auth.Forbid(w, r, "retrying tasks requires operator role")
+			return
+		}
+		taskRetryHandler(w, r, collector, config, taskID)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
 	case "GET":
 		// 获取任务详情
-		if task, exists := taskmanager.GlobalTaskManager.GetTask(taskID); exists {
+		if task, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID); exists {
 			json.NewEncoder(w).Encode(task)
 		} else {
-			http.Error(w, "Task not found", http.StatusNotFound)
+			writeTaskNotFound(w, r, taskID)
 		}
 
 	case "DELETE":
 		// 取消任务
-		taskmanager.GlobalTaskManager.CancelTask(taskID)
-		w.WriteHeader(http.StatusOK)
+		if !auth.Allowed(r, auth.PermCancelTask) {
+			auth.Forbid(w, r, "cancelling tasks requires admin role")
+			return
+		}
+		switch err := taskmanager.GlobalTaskManager.CancelTask(taskID); {
+		case errors.Is(err, taskmanager.ErrTaskNotFound):
+			writeTaskNotFound(w, r, taskID)
+		case err != nil:
+			api.WriteError(w, r, http.StatusConflict, api.CodeConflict, err.Error(), map[string]string{"taskId": taskID})
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		api.MethodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// writeTaskNotFound 返回任务不存在的 404 错误
+func writeTaskNotFound(w http.ResponseWriter, r *http.Request, taskID string) {
+	api.WriteError(w, r, http.StatusNotFound, api.CodeNotFound, "Task not found", map[string]string{"taskId": taskID})
+}
+
+// sseHeartbeatInterval SSE心跳间隔，防止代理因空闲断开连接
+const sseHeartbeatInterval = 15 * time.Second
+
+// taskEventsHandler 通过Server-Sent Events推送任务步骤、指标进度和日志
+func taskEventsHandler(w http.ResponseWriter, r *http.Request, taskID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.WriteError(w, r, http.StatusInternalServerError, api.CodeInternal, "Streaming unsupported", nil)
+		return
+	}
+
+	// 先订阅再取快照，避免两者之间的事件丢失
+	events, unsubscribe := taskmanager.GlobalTaskManager.Subscribe(taskID)
+	defer unsubscribe()
+
+	snapshot, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID)
+	if !exists {
+		writeTaskNotFound(w, r, taskID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	if err := writeTaskEvent(w, snapshotEvent(snapshot)); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	if snapshot.Status.Finished() {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// 消费过慢被取消订阅，结束事件流，客户端重连后从快照恢复
+				return
+			}
+			if err := writeTaskEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+			if event.Type == taskmanager.EventStatus && event.Status.Finished() {
+				return
+			}
+		case <-heartbeat.C:
+			// 兜底检查任务状态，任务已结束时推送最终快照并结束事件流
+			if snapshot, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID); !exists || snapshot.Status.Finished() {
+				if exists {
+					writeTaskEvent(w, snapshotEvent(snapshot))
+					flusher.Flush()
+				}
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// snapshotEvent 以任务快照构造 snapshot 事件
+func snapshotEvent(snapshot taskmanager.InspectionTask) taskmanager.TaskEvent {
+	return taskmanager.TaskEvent{
+		Type:     taskmanager.EventSnapshot,
+		TaskID:   snapshot.ID,
+		Time:     time.Now(),
+		Status:   snapshot.Status,
+		Progress: snapshot.Progress,
+		Task:     &snapshot,
+	}
+}
+
+// writeTaskEvent 按SSE格式写出单个任务事件
+func writeTaskEvent(w http.ResponseWriter, event taskmanager.TaskEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("编码任务事件失败", logging.KeyTaskID, event.TaskID, logging.Err(err))
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+	return err
+}
+
+// taskRetryHandler 以原任务的数据源、指标范围和通知参数重新执行巡检，新任务通过 retryOf 关联原任务
+func taskRetryHandler(w http.ResponseWriter, r *http.Request, collector *metrics.Collector, config *config.Config, taskID string) {
+	original, exists := taskmanager.GlobalTaskManager.GetTaskSnapshot(taskID)
+	if !exists {
+		writeTaskNotFound(w, r, taskID)
+		return
+	}
+	if !authorizeDatasource(w, r, original.Options.Datasource) {
+		return
+	}
+	if _, err := resolveDatasource(config, original.Options.Datasource); err != nil {
+		writeDatasourceError(w, r, original.Options.Datasource, err)
+		return
+	}
+
+	if taskmanager.GlobalTaskManager.ShuttingDown() {
+		api.WriteError(w, r, http.StatusServiceUnavailable, api.CodeShuttingDown, "Server is shutting down", nil)
+		return
 	}
+
+	steps := buildInspectionSteps(config.Select(original.Options.MetricTypes, original.Options.Tags))
+	task, err := taskmanager.GlobalTaskManager.CreateRetryTask(taskID, steps)
+	if err != nil {
+		api.WriteError(w, r, http.StatusConflict, api.CodeConflict, err.Error(), map[string]string{"taskId": taskID})
+		return
+	}
+
+	// 请求结束后巡检仍在后台执行，复制请求用于通知中的动态URL生成
+	ctx := context.WithValue(context.Background(), "http_request", r.Clone(context.Background()))
+	go func() {
+		if _, err := runInspection(ctx, collector, config, task.ID); err != nil {
+			slog.Error("重试任务失败", logging.KeyTaskID, task.ID, "retry_of", taskID, logging.Err(err))
+		}
+	}()
+
+	snapshot, _ := taskmanager.GlobalTaskManager.GetTaskSnapshot(task.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(snapshot)
 }
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Version 当前 API 版本，版本化接口挂载在 <base_path>/v1 下
+const Version = "v1"
+
+// 错误码
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeDatasourceNotFound = "datasource_not_found"
+	CodeDatasourceBlocked  = "datasource_blocked"
+	CodeDatasourceError    = "datasource_error"
+	CodeInvalidConfig      = "invalid_config"
+	CodeShuttingDown       = "shutting_down"
+	CodeInternal           = "internal_error"
+)
+
+// Error 统一的错误信息
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// ErrorResponse 错误响应体：{"error": {"code": ..., "message": ..., "details": ...}}
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// WriteJSON 以 JSON 格式写出响应
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError 写出错误响应：浏览器页面请求（Accept 优先 text/html）返回纯文本，其余返回 JSON 错误信封
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	if r != nil && PrefersHTML(r) {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	WriteJSON(w, status, ErrorResponse{Error: Error{Code: code, Message: message, Details: details}})
+}
+
+// MethodNotAllowed 写出 405 错误并设置 Allow 头
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	WriteError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method "+r.Method+" not allowed", map[string]interface{}{"allowed": allowed})
+}
+
+// WantsJSON 判断请求的 Accept 头是否优先 application/json（高于 text/html 且显式声明）
+func WantsJSON(r *http.Request) bool {
+	jsonQ, htmlQ := acceptQuality(r.Header.Get("Accept"))
+	return jsonQ > 0 && jsonQ >= htmlQ
+}
+
+// PrefersHTML 判断请求的 Accept 头是否优先 text/html，如浏览器直接打开的页面
+func PrefersHTML(r *http.Request) bool {
+	jsonQ, htmlQ := acceptQuality(r.Header.Get("Accept"))
+	return htmlQ > 0 && htmlQ > jsonQ
+}
+
+// acceptQuality 解析 Accept 头中 application/json 和 text/html 的显式权重，通配符不计入
+func acceptQuality(accept string) (jsonQ, htmlQ float64) {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	return jsonQ, htmlQ
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openapiSpec []byte
+
+// OpenAPIHandler 返回 OpenAPI 文档，servers 按实际的路由前缀和版本生成
+func OpenAPIHandler(basePath string) (http.HandlerFunc, error) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(openapiSpec, &spec); err != nil {
+		return nil, err
+	}
+	spec["servers"] = []map[string]string{{"url": basePath + "/" + Version}}
+	body, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			MethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(body)
+	}, nil
+}
@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"PromAI/pkg/api"
+	"PromAI/pkg/logging"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config 认证配置，多种认证方式可同时启用，任一方式通过即视为已认证
+type Config struct {
+	Enabled    bool          `yaml:"enabled"`
+	Tokens     []TokenConfig `yaml:"tokens"`
+	BasicUsers []UserConfig  `yaml:"basic_users"`
+	Proxy      ProxyConfig   `yaml:"proxy"`
+}
+
+// TokenConfig 静态API令牌，通过 Authorization: Bearer <token> 或 X-API-Token 头传入
+type TokenConfig struct {
+	Name        string   `yaml:"name"`
+	Token       string   `yaml:"token"`
+	Role        string   `yaml:"role"`        // viewer（默认）、operator、admin
+	Datasources []string `yaml:"datasources"` // 可访问的数据源名称，为空表示不限制
+}
+
+// UserConfig HTTP Basic 认证用户，密码以 bcrypt 哈希保存
+type UserConfig struct {
+	Username     string   `yaml:"username"`
+	PasswordHash string   `yaml:"password_hash"`
+	Role         string   `yaml:"role"`
+	Datasources  []string `yaml:"datasources"`
+}
+
+// ProxyConfig 受信任反向代理模式，仅信任来自 trusted_proxies 的请求携带的用户头
+type ProxyConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	UserHeader     string   `yaml:"user_header"`
+	TrustedProxies []string `yaml:"trusted_proxies"` // CIDR 或单个IP
+	RoleHeader     string   `yaml:"role_header"`     // 传入角色的请求头，为空或值为空时使用 default_role
+	DefaultRole    string   `yaml:"default_role"`
+	Datasources    []string `yaml:"datasources"`
+}
+
+// Identity 已认证的调用方
+type Identity struct {
+	Name        string   `json:"name"`
+	Method      string   `json:"method"` // token, basic, proxy
+	Role        Role     `json:"role"`
+	Datasources []string `json:"datasources,omitempty"`
+}
+
+// Authenticator 认证方式，无法识别请求中的凭据时返回 false
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, bool)
+}
+
+type contextKey struct{}
+
+// FromContext 获取请求上下文中的已认证身份
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok
+}
+
+// Middleware 认证中间件
+type Middleware struct {
+	authenticators []Authenticator
+	basicEnabled   bool
+}
+
+// New 根据配置创建认证中间件，未启用认证时返回 nil
+func New(cfg Config) (*Middleware, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	m := &Middleware{}
+	if len(cfg.Tokens) > 0 {
+		tokens := &tokenAuthenticator{}
+		for i, t := range cfg.Tokens {
+			if t.Token == "" {
+				return nil, fmt.Errorf("auth.tokens[%d]: token is empty", i)
+			}
+			role, err := ParseRole(t.Role)
+			if err != nil {
+				return nil, fmt.Errorf("auth.tokens[%d] (%s): %w", i, t.Name, err)
+			}
+			tokens.tokens = append(tokens.tokens, tokenEntry{
+				token:    []byte(t.Token),
+				identity: Identity{Name: t.Name, Method: "token", Role: role, Datasources: t.Datasources},
+			})
+		}
+		m.authenticators = append(m.authenticators, tokens)
+	}
+
+	if len(cfg.BasicUsers) > 0 {
+		basic := &basicAuthenticator{users: make(map[string]basicUser)}
+		maxCost := bcrypt.MinCost
+		for i, u := range cfg.BasicUsers {
+			if u.Username == "" {
+				return nil, fmt.Errorf("auth.basic_users[%d]: username is empty", i)
+			}
+			cost, err := bcrypt.Cost([]byte(u.PasswordHash))
+			if err != nil {
+				return nil, fmt.Errorf("auth.basic_users[%d] (%s): invalid bcrypt password_hash: %w", i, u.Username, err)
+			}
+			maxCost = max(maxCost, cost)
+			role, err := ParseRole(u.Role)
+			if err != nil {
+				return nil, fmt.Errorf("auth.basic_users[%d] (%s): %w", i, u.Username, err)
+			}
+			basic.users[u.Username] = basicUser{
+				hash:     []byte(u.PasswordHash),
+				identity: Identity{Name: u.Username, Method: "basic", Role: role, Datasources: u.Datasources},
+			}
+		}
+		dummy, err := bcrypt.GenerateFromPassword([]byte("promai-unknown-user"), maxCost)
+		if err != nil {
+			return nil, fmt.Errorf("auth.basic_users: %w", err)
+		}
+		basic.dummyHash = dummy
+		m.authenticators = append(m.authenticators, basic)
+		m.basicEnabled = true
+	}
+
+	if cfg.Proxy.Enabled {
+		proxy, err := newProxyAuthenticator(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		m.authenticators = append(m.authenticators, proxy)
+	}
+
+	if len(m.authenticators) == 0 {
+		return nil, fmt.Errorf("auth is enabled but no tokens, basic_users or proxy are configured")
+	}
+	return m, nil
+}
+
+// Wrap 为处理器增加认证，未认证的请求返回 401
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, a := range m.authenticators {
+			if identity, ok := a.Authenticate(r); ok {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, identity)))
+				return
+			}
+		}
+
+		slog.Warn("拒绝未认证请求", logging.KeyMethod, r.Method, logging.KeyPath, r.URL.Path, logging.KeyRemote, r.RemoteAddr)
+		if m.basicEnabled {
+			w.Header().Set("WWW-Authenticate", `Basic realm="PromAI", charset="UTF-8"`)
+		}
+		api.WriteError(w, r, http.StatusUnauthorized, api.CodeUnauthorized, "Unauthorized", nil)
+	})
+}
+
+// HashPassword 生成用于 basic_users.password_hash 的 bcrypt 哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// tokenAuthenticator 静态API令牌认证
+type tokenAuthenticator struct {
+	tokens []tokenEntry
+}
+
+type tokenEntry struct {
+	token    []byte
+	identity Identity
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (*Identity, bool) {
+	token := r.Header.Get("X-API-Token")
+	if bearer := r.Header.Get("Authorization"); token == "" && strings.HasPrefix(bearer, "Bearer ") {
+		token = strings.TrimPrefix(bearer, "Bearer ")
+	}
+	if token == "" {
+		return nil, false
+	}
+
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), t.token) == 1 {
+			identity := t.identity
+			return &identity, true
+		}
+	}
+	return nil, false
+}
+
+// basicAuthenticator HTTP Basic 认证
+type basicAuthenticator struct {
+	users map[string]basicUser
+	// dummyHash 用户不存在时用于比较的哈希，代价与配置中最高的相同，避免通过响应时间判断用户名是否存在
+	dummyHash []byte
+}
+
+type basicUser struct {
+	hash     []byte
+	identity Identity
+}
+
+func (a *basicAuthenticator) Authenticate(r *http.Request) (*Identity, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+	user, exists := a.users[username]
+	hash := user.hash
+	if !exists {
+		hash = a.dummyHash
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !exists {
+		return nil, false
+	}
+	identity := user.identity
+	return &identity, true
+}
+
+// proxyAuthenticator 受信任反向代理认证
+type proxyAuthenticator struct {
+	userHeader  string
+	roleHeader  string
+	defaultRole Role
+	datasources []string
+	trusted     []*net.IPNet
+}
+
+func newProxyAuthenticator(cfg ProxyConfig) (*proxyAuthenticator, error) {
+	defaultRole, err := ParseRole(cfg.DefaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("auth.proxy.default_role: %w", err)
+	}
+	a := &proxyAuthenticator{
+		userHeader:  cfg.UserHeader,
+		roleHeader:  cfg.RoleHeader,
+		defaultRole: defaultRole,
+		datasources: cfg.Datasources,
+	}
+	if a.userHeader == "" {
+		a.userHeader = "X-Forwarded-User"
+	}
+	if len(cfg.TrustedProxies) == 0 {
+		return nil, fmt.Errorf("auth.proxy.trusted_proxies is required when proxy auth is enabled")
+	}
+	for _, entry := range cfg.TrustedProxies {
+		network, err := parseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("auth.proxy.trusted_proxies: %w", err)
+		}
+		a.trusted = append(a.trusted, network)
+	}
+	return a, nil
+}
+
+func (a *proxyAuthenticator) Authenticate(r *http.Request) (*Identity, bool) {
+	user := strings.TrimSpace(r.Header.Get(a.userHeader))
+	if user == "" || !a.fromTrustedProxy(r) {
+		return nil, false
+	}
+
+	role := a.defaultRole
+	if a.roleHeader != "" {
+		if value := strings.TrimSpace(r.Header.Get(a.roleHeader)); value != "" {
+			parsed, err := ParseRole(value)
+			if err != nil {
+				slog.Warn("代理传入的角色无效，拒绝请求", logging.KeyUser, user, logging.Err(err))
+				return nil, false
+			}
+			role = parsed
+		}
+	}
+	return &Identity{Name: user, Method: "proxy", Role: role, Datasources: a.datasources}, true
+}
+
+// fromTrustedProxy 判断请求的直连地址是否为受信任的代理
+func (a *proxyAuthenticator) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDR 解析CIDR，单个IP按 /32 或 /128 处理
+func parseCIDR(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+	}
+	return network, nil
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authenticate 使用中间件认证请求，返回认证后的身份，未通过认证时返回 nil
+func authenticate(t *testing.T, m *Middleware, r *http.Request) *Identity {
+	t.Helper()
+	var identity *Identity
+	w := httptest.NewRecorder()
+	m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = FromContext(r.Context())
+	})).ServeHTTP(w, r)
+	if identity == nil && w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated request: status = %d, want 401", w.Code)
+	}
+	return identity
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		err  string
+	}{
+		{name: "未启用", cfg: Config{}},
+		{name: "未配置认证方式", cfg: Config{Enabled: true}, err: "no tokens, basic_users or proxy are configured"},
+		{name: "空令牌", cfg: Config{Enabled: true, Tokens: []TokenConfig{{Name: "ci"}}}, err: "auth.tokens[0]: token is empty"},
+		{name: "未知角色", cfg: Config{Enabled: true, Tokens: []TokenConfig{{Name: "ci", Token: "t", Role: "root"}}}, err: `auth.tokens[0] (ci): unknown role "root"`},
+		{name: "非法哈希", cfg: Config{Enabled: true, BasicUsers: []UserConfig{{Username: "ops", PasswordHash: "secret"}}}, err: "invalid bcrypt password_hash"},
+		{name: "代理缺少受信任地址", cfg: Config{Enabled: true, Proxy: ProxyConfig{Enabled: true}}, err: "trusted_proxies is required"},
+		{name: "非法代理地址", cfg: Config{Enabled: true, Proxy: ProxyConfig{Enabled: true, TrustedProxies: []string{"10.0.0.300"}}}, err: "invalid IP or CIDR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(tt.cfg)
+			if tt.err == "" {
+				if err != nil || m != nil {
+					t.Fatalf("New() = %v, %v; want nil middleware", m, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("New() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	m, err := New(Config{Enabled: true, Tokens: []TokenConfig{
+		{Name: "ci", Token: "ci-token-123", Role: "operator", Datasources: []string{"cluster1"}},
+	}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		ok     bool
+	}{
+		{name: "Bearer 令牌", header: "Authorization", value: "Bearer ci-token-123", ok: true},
+		{name: "X-API-Token", header: "X-API-Token", value: "ci-token-123", ok: true},
+		{name: "错误的令牌", header: "Authorization", value: "Bearer ci-token-124"},
+		{name: "令牌前缀", header: "Authorization", value: "Bearer ci-token"},
+		{name: "缺少 Bearer", header: "Authorization", value: "ci-token-123"},
+		{name: "未携带令牌"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/promai/tasks", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			identity := authenticate(t, m, r)
+			if !tt.ok {
+				if identity != nil {
+					t.Fatalf("identity = %+v, want unauthenticated", identity)
+				}
+				return
+			}
+			if identity == nil || identity.Name != "ci" || identity.Method != "token" || identity.Role != RoleOperator || len(identity.Datasources) != 1 {
+				t.Fatalf("identity = %+v, want ci operator scoped to cluster1", identity)
+			}
+		})
+	}
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(Config{Enabled: true, BasicUsers: []UserConfig{{Username: "ops", PasswordHash: string(hash), Role: "admin"}}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		username string
+		password string
+		noHeader bool
+		ok       bool
+	}{
+		{name: "正确的密码", username: "ops", password: "correct horse", ok: true},
+		{name: "错误的密码", username: "ops", password: "correct horse!"},
+		{name: "空密码", username: "ops", password: ""},
+		{name: "不存在的用户", username: "root", password: "correct horse"},
+		{name: "未携带凭据", noHeader: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/promai/tasks", nil)
+			if !tt.noHeader {
+				r.SetBasicAuth(tt.username, tt.password)
+			}
+			identity := authenticate(t, m, r)
+			if tt.ok != (identity != nil) {
+				t.Fatalf("identity = %+v, want authenticated %t", identity, tt.ok)
+			}
+			if tt.ok && (identity.Name != "ops" || identity.Method != "basic" || identity.Role != RoleAdmin) {
+				t.Fatalf("identity = %+v, want ops admin", identity)
+			}
+		})
+	}
+
+	// 未认证时提示浏览器使用 Basic 认证
+	w := httptest.NewRecorder()
+	m.Wrap(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/promai/tasks", nil))
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+		t.Fatalf("status = %d, WWW-Authenticate = %q; want 401 with a Basic challenge", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestBasicAuthenticatorDummyHashCost(t *testing.T) {
+	low, _ := bcrypt.GenerateFromPassword([]byte("a"), bcrypt.MinCost)
+	high, _ := bcrypt.GenerateFromPassword([]byte("b"), bcrypt.MinCost+2)
+	m, err := New(Config{Enabled: true, BasicUsers: []UserConfig{
+		{Username: "low", PasswordHash: string(low)},
+		{Username: "high", PasswordHash: string(high)},
+	}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// 不存在的用户与最慢的已有用户耗时相同
+	basic := m.authenticators[0].(*basicAuthenticator)
+	if cost, err := bcrypt.Cost(basic.dummyHash); err != nil || cost != bcrypt.MinCost+2 {
+		t.Fatalf("dummy hash cost = %d, %v; want %d", cost, err, bcrypt.MinCost+2)
+	}
+}
+
+func TestProxyAuthenticator(t *testing.T) {
+	m, err := New(Config{Enabled: true, Proxy: ProxyConfig{
+		Enabled:        true,
+		RoleHeader:     "X-Forwarded-Role",
+		DefaultRole:    "viewer",
+		TrustedProxies: []string{"10.0.0.0/8", "fd00::/8", "192.168.1.5"},
+	}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		user       string
+		role       string
+		want       Role // 为空时应拒绝
+	}{
+		{name: "受信任网段", remoteAddr: "10.1.2.3:51234", user: "alice", want: RoleViewer},
+		{name: "受信任的单个IP", remoteAddr: "192.168.1.5:51234", user: "alice", want: RoleViewer},
+		{name: "传入角色", remoteAddr: "10.1.2.3:51234", user: "alice", role: "operator", want: RoleOperator},
+		{name: "非法角色", remoteAddr: "10.1.2.3:51234", user: "alice", role: "root"},
+		{name: "不受信任的地址", remoteAddr: "192.168.1.6:51234", user: "alice"},
+		{name: "缺少用户头", remoteAddr: "10.1.2.3:51234"},
+		{name: "IPv6 受信任", remoteAddr: "[fd00::1]:51234", user: "alice", want: RoleViewer},
+		{name: "IPv6 不受信任", remoteAddr: "[fe80::1]:51234", user: "alice"},
+		{name: "IPv6 回环", remoteAddr: "[::1]:51234", user: "alice"},
+		{name: "IPv6 带区域", remoteAddr: "[fd00::1%eth0]:51234", user: "alice"},
+		{name: "IPv6 无端口", remoteAddr: "fd00::1", user: "alice", want: RoleViewer},
+		{name: "IPv4 映射的 IPv6", remoteAddr: "[::ffff:10.1.2.3]:51234", user: "alice", want: RoleViewer},
+		{name: "非法地址", remoteAddr: "proxy.internal:51234", user: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/promai/tasks", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.user != "" {
+				r.Header.Set("X-Forwarded-User", tt.user)
+			}
+			if tt.role != "" {
+				r.Header.Set("X-Forwarded-Role", tt.role)
+			}
+			identity := authenticate(t, m, r)
+			if tt.want == "" {
+				if identity != nil {
+					t.Fatalf("identity = %+v, want unauthenticated", identity)
+				}
+				return
+			}
+			if identity == nil || identity.Name != tt.user || identity.Method != "proxy" || identity.Role != tt.want {
+				t.Fatalf("identity = %+v, want %s with role %s", identity, tt.user, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"PromAI/pkg/api"
+	"PromAI/pkg/logging"
+)
+
+// Role 角色，权限逐级包含：viewer < operator < admin
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // 查看报告、任务和状态页面
+	RoleOperator Role = "operator" // 在已配置的数据源上发起巡检、重试任务、查看生效配置
+	RoleAdmin    Role = "admin"    // 使用自定义数据源URL、取消任务、重新加载配置、编辑指标定义
+)
+
+// Permission 路由权限
+type Permission string
+
+const (
+	PermView             Permission = "view"
+	PermInspect          Permission = "inspect"
+	PermCustomDatasource Permission = "custom_datasource"
+	PermCancelTask       Permission = "cancel_task"
+	PermReloadConfig     Permission = "reload_config"
+	PermViewConfig       Permission = "view_config"
+	PermEditMetrics      Permission = "edit_metrics"
+)
+
+// DefaultDatasource 未指定 datasource 参数时（即使用 prometheus_url）在数据源范围中的名称
+const DefaultDatasource = "default"
+
+// rolePermissions 每个角色拥有的权限
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:   {PermView},
+	RoleOperator: {PermView, PermInspect, PermViewConfig},
+	RoleAdmin:    {PermView, PermInspect, PermViewConfig, PermCustomDatasource, PermCancelTask, PermReloadConfig, PermEditMetrics},
+}
+
+// ParseRole 解析角色名称，为空时返回 viewer
+func ParseRole(name string) (Role, error) {
+	if name == "" {
+		return RoleViewer, nil
+	}
+	role := Role(name)
+	if _, exists := rolePermissions[role]; !exists {
+		return "", fmt.Errorf("unknown role %q (expected viewer, operator or admin)", name)
+	}
+	return role, nil
+}
+
+// Allows 判断角色是否拥有指定权限
+func (r Role) Allows(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessAllDatasources 判断身份是否不受数据源范围限制：未配置数据源范围或范围中包含 *
+func (i *Identity) CanAccessAllDatasources() bool {
+	if len(i.Datasources) == 0 {
+		return true
+	}
+	for _, ds := range i.Datasources {
+		if ds == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessDatasource 判断身份是否可以访问指定名称的数据源，未配置数据源范围时不限制
+func (i *Identity) CanAccessDatasource(name string) bool {
+	if len(i.Datasources) == 0 {
+		return true
+	}
+	if name == "" {
+		name = DefaultDatasource
+	}
+	for _, ds := range i.Datasources {
+		if ds == "*" || ds == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed 判断请求方是否拥有指定权限，未启用认证（请求中没有身份）时始终允许
+func Allowed(r *http.Request, perm Permission) bool {
+	identity, ok := FromContext(r.Context())
+	if !ok {
+		return true
+	}
+	return identity.Role.Allows(perm)
+}
+
+// AllowedDatasource 判断请求方是否可以访问指定名称的数据源，未启用认证时始终允许
+func AllowedDatasource(r *http.Request, name string) bool {
+	identity, ok := FromContext(r.Context())
+	if !ok {
+		return true
+	}
+	return identity.CanAccessDatasource(name)
+}
+
+// AllowedAllDatasources 判断请求方是否不受数据源范围限制（未配置范围或包含 *），未启用认证时始终允许
+func AllowedAllDatasources(r *http.Request) bool {
+	identity, ok := FromContext(r.Context())
+	if !ok {
+		return true
+	}
+	return identity.CanAccessAllDatasources()
+}
+
+// Require 为处理器增加权限检查，缺少权限时返回 403
+func Require(perm Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Allowed(r, perm) {
+			Forbid(w, r, fmt.Sprintf("permission %q required", perm))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Forbid 记录并返回 403
+func Forbid(w http.ResponseWriter, r *http.Request, reason string) {
+	name, role := "anonymous", Role("")
+	if identity, ok := FromContext(r.Context()); ok {
+		name, role = identity.Name, identity.Role
+	}
+	slog.Warn("拒绝越权请求", logging.KeyMethod, r.Method, logging.KeyPath, r.URL.Path, logging.KeyUser, name, "role", role, "reason", reason)
+	api.WriteError(w, r, http.StatusForbidden, api.CodeForbidden, "Forbidden: "+reason, nil)
+}
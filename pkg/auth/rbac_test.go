@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withIdentity 返回带有已认证身份的请求
+func withIdentity(identity *Identity) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/promai/tasks", nil)
+	if identity == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, identity))
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		name string
+		want Role
+		err  bool
+	}{
+		{name: "", want: RoleViewer},
+		{name: "viewer", want: RoleViewer},
+		{name: "operator", want: RoleOperator},
+		{name: "admin", want: RoleAdmin},
+		{name: "Admin", err: true},
+		{name: "root", err: true},
+	}
+	for _, tt := range tests {
+		role, err := ParseRole(tt.name)
+		if (err != nil) != tt.err || role != tt.want {
+			t.Errorf("ParseRole(%q) = %q, %v; want %q, error %t", tt.name, role, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	all := []Permission{PermView, PermInspect, PermViewConfig, PermCustomDatasource, PermCancelTask, PermReloadConfig, PermEditMetrics}
+	granted := map[Role][]Permission{
+		RoleViewer:   {PermView},
+		RoleOperator: {PermView, PermInspect, PermViewConfig},
+		RoleAdmin:    all,
+		Role("root"): nil,
+	}
+	for role, perms := range granted {
+		for _, perm := range all {
+			want := false
+			for _, p := range perms {
+				want = want || p == perm
+			}
+			if got := role.Allows(perm); got != want {
+				t.Errorf("%s.Allows(%s) = %t, want %t", role, perm, got, want)
+			}
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity *Identity
+		perm     Permission
+		want     bool
+	}{
+		{name: "未启用认证", identity: nil, perm: PermEditMetrics, want: true},
+		{name: "viewer 查看", identity: &Identity{Role: RoleViewer}, perm: PermView, want: true},
+		{name: "viewer 巡检", identity: &Identity{Role: RoleViewer}, perm: PermInspect},
+		{name: "viewer 查看配置", identity: &Identity{Role: RoleViewer}, perm: PermViewConfig},
+		{name: "operator 查看配置", identity: &Identity{Role: RoleOperator}, perm: PermViewConfig, want: true},
+		{name: "operator 取消任务", identity: &Identity{Role: RoleOperator}, perm: PermCancelTask},
+		{name: "admin 编辑指标", identity: &Identity{Role: RoleAdmin}, perm: PermEditMetrics, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allowed(withIdentity(tt.identity), tt.perm); got != tt.want {
+				t.Fatalf("Allowed(%s) = %t, want %t", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedDatasource(t *testing.T) {
+	tests := []struct {
+		name       string
+		identity   *Identity
+		datasource string
+		want       bool
+		wantAll    bool
+	}{
+		{name: "未启用认证", identity: nil, datasource: "cluster1", want: true, wantAll: true},
+		{name: "不限范围", identity: &Identity{Role: RoleViewer}, datasource: "cluster1", want: true, wantAll: true},
+		{name: "通配", identity: &Identity{Datasources: []string{"*"}}, datasource: "cluster2", want: true, wantAll: true},
+		{name: "范围内", identity: &Identity{Datasources: []string{"cluster1"}}, datasource: "cluster1", want: true},
+		{name: "范围外", identity: &Identity{Datasources: []string{"cluster1"}}, datasource: "cluster2"},
+		{name: "默认数据源", identity: &Identity{Datasources: []string{"default"}}, datasource: "", want: true},
+		{name: "默认数据源不在范围内", identity: &Identity{Datasources: []string{"cluster1"}}, datasource: ""},
+		{name: "自定义URL", identity: &Identity{Datasources: []string{"cluster1"}}, datasource: "http://10.0.0.5:9090"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withIdentity(tt.identity)
+			if got := AllowedDatasource(r, tt.datasource); got != tt.want {
+				t.Fatalf("AllowedDatasource(%q) = %t, want %t", tt.datasource, got, tt.want)
+			}
+			if got := AllowedAllDatasources(r); got != tt.wantAll {
+				t.Fatalf("AllowedAllDatasources() = %t, want %t", got, tt.wantAll)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	handler := Require(PermInspect, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		identity *Identity
+		want     int
+	}{
+		{identity: nil, want: http.StatusNoContent},
+		{identity: &Identity{Name: "v", Role: RoleViewer}, want: http.StatusForbidden},
+		{identity: &Identity{Name: "o", Role: RoleOperator}, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withIdentity(tt.identity))
+		if w.Code != tt.want {
+			t.Errorf("identity %+v: status = %d, want %d", tt.identity, w.Code, tt.want)
+		}
+	}
+}
@@ -1,13 +1,40 @@
 package config
 
-import "PromAI/pkg/notify"
+import (
+	"PromAI/pkg/auth"
+	"PromAI/pkg/health"
+	"PromAI/pkg/logging"
+	"PromAI/pkg/notify"
+	"PromAI/pkg/prometheus"
+	"PromAI/pkg/server"
+)
 
 type Config struct {
-	PrometheusURL string       `yaml:"prometheus_url"`
-	DataSources   []DataSource `yaml:"data_sources"`
-	MetricTypes   []MetricType `yaml:"metric_types"`
-	ProjectName   string       `yaml:"project_name"`
-	CronSchedule  string       `yaml:"cron_schedule"`
+	// Version 配置文件格式版本，未设置时按版本 1 读取，旧版本在加载时升级到 CurrentVersion 并输出废弃警告
+	Version       int    `yaml:"version"`
+	PrometheusURL string `yaml:"prometheus_url"`
+	// PrometheusAuth 连接 prometheus_url 的认证配置
+	PrometheusAuth prometheus.Auth `yaml:"prometheus_auth"`
+	DataSources    []DataSource    `yaml:"data_sources"`
+	// DatasourcePolicy 请求中自定义数据源URL的访问策略，防止被用于探测内网（SSRF）
+	DatasourcePolicy prometheus.URLPolicyConfig `yaml:"datasource_policy"`
+	MetricTypes      []MetricType               `yaml:"metric_types"`
+	// Packs 引用的内置规则包（如 node-exporter、kube-state-metrics@1.0.0），其中的指标类型排在 metric_types 之前
+	// metric_types 中与规则包同名的指标类型用于覆盖规则包中的指标
+	Packs []string `yaml:"packs"`
+	// Include 引入其他指标文件（如 metrics.d/*.yaml），其中的 metric_types 按顺序追加在本文件之后
+	Include []string `yaml:"include"`
+	// OverlayFile 保存通过接口编辑的指标定义，相对路径相对于配置文件所在目录，为空时不允许通过接口编辑
+	OverlayFile  string `yaml:"overlay_file"`
+	ProjectName  string `yaml:"project_name"`
+	CronSchedule string `yaml:"cron_schedule"`
+	// ScheduleTags 定时巡检仅包含带有其中任一标签的指标，为空时巡检全部启用的指标
+	ScheduleTags []string `yaml:"schedule_tags"`
+	// ScheduleRetry 定时巡检失败后的自动重试策略，max_attempts 为 0 时不重试
+	ScheduleRetry struct {
+		MaxAttempts int `yaml:"max_attempts"`
+		Interval    int `yaml:"interval"` // 重试间隔（秒）
+	} `yaml:"schedule_retry"`
 	ReportCleanup struct {
 		Enabled      bool   `yaml:"enabled"`
 		MaxAge       int    `yaml:"max_age"`
@@ -19,25 +46,59 @@ type Config struct {
 		WeChatWork notify.WeChatWorkConfig `yaml:"wechat_work"`
 	} `yaml:"notifications"`
 	Port string `yaml:"port"`
+	// Server 对外地址、路由前缀和 HTTPS 配置
+	Server server.Config `yaml:"server"`
+	// ShutdownGracePeriod 收到退出信号后等待执行中巡检和通知完成的最长时间（秒），默认 30
+	ShutdownGracePeriod int `yaml:"shutdown_grace_period"`
+	// Auth HTTP 接口与页面的认证配置，未启用时允许匿名访问
+	Auth auth.Config `yaml:"auth"`
+	// Log 日志级别与格式，可被 -log-level / -log-format 参数覆盖
+	Log logging.Config `yaml:"log"`
+	// Health /readyz 就绪检查配置
+	Health health.Config `yaml:"health"`
+
+	hash        string       // 配置文件内容的 SHA-256
+	sources     []Source     // 取值不是直接来自配置文件的配置项
+	base        []MetricType // 应用 overlay 之前的指标类型
+	overlayPath string       // overlay_file 的实际路径
+	warnings    []FieldError // 旧版本配置项的废弃警告
 }
 
 type DataSource struct {
 	Name string `yaml:"name"`
 	URL  string `yaml:"url"`
+	// Auth 连接该数据源的认证配置（basic_auth 或 bearer_token）
+	Auth prometheus.Auth `yaml:",inline"`
 }
 
 type MetricType struct {
-	Type    string         `yaml:"type"`
-	Metrics []MetricConfig `yaml:"metrics"`
+	Type    string         `yaml:"type" json:"type"`
+	Metrics []MetricConfig `yaml:"metrics" json:"metrics"`
 }
 
 type MetricConfig struct {
-	Name           string            `yaml:"name"`
-	Description    string            `yaml:"description"`
-	Query          string            `yaml:"query"`
-	Threshold      float64           `yaml:"threshold"`
-	Unit           string            `yaml:"unit"`
-	Labels         map[string]string `yaml:"labels"`
-	ThresholdType  string            `yaml:"threshold_type"`
-	ThresholdStatus string           `yaml:"threshold_status"`
+	Name          string            `yaml:"name" json:"name"`
+	Description   string            `yaml:"description,omitempty" json:"description"`
+	Query         string            `yaml:"query" json:"query"`
+	Threshold     float64           `yaml:"threshold" json:"threshold"`
+	Unit          string            `yaml:"unit,omitempty" json:"unit"`
+	Labels        map[string]string `yaml:"labels" json:"labels"`
+	ThresholdType string            `yaml:"threshold_type,omitempty" json:"threshold_type"`
+	// ThresholdStatus 版本 1 的配置项，加载时迁移为 HealthyWhenMet
+	ThresholdStatus string `yaml:"threshold_status,omitempty" json:"threshold_status,omitempty"`
+	// HealthyWhenMet 为 true 时满足阈值条件为正常、远离阈值为严重，用于"必须等于"一类的检查
+	HealthyWhenMet bool `yaml:"healthy_when_met,omitempty" json:"healthy_when_met,omitempty"`
+	// Enabled 为 false 时巡检和状态页跳过该指标，未配置时启用
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// Tags 指标标签，巡检时可按标签筛选（tags 参数、schedule_tags）
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Owner 负责人或团队，Severity 为异常时的影响级别，RunbookURL 为处理手册地址，均显示在报告和通知中
+	Owner      string `yaml:"owner,omitempty" json:"owner,omitempty"`
+	RunbookURL string `yaml:"runbook_url,omitempty" json:"runbook_url,omitempty"`
+	Severity   string `yaml:"severity,omitempty" json:"severity,omitempty"`
+}
+
+// IsEnabled 指标是否参与巡检，未配置 enabled 时启用
+func (m MetricConfig) IsEnabled() bool {
+	return m.Enabled == nil || *m.Enabled
 }
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"PromAI/pkg/redact"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 配置项取值的来源，未记录来源的配置项来自配置文件
+const (
+	SourceEnv  = "env"  // 环境变量：${VAR} 引用或 PROMETHEUS_URL
+	SourceFile = "file" // *_file 指定的密钥文件或 include 引入的指标文件
+	SourceFlag = "flag" // 启动参数，如 -log-level
+	SourcePack = "pack" // 内置规则包
+	// SourceMigration 由旧版本的配置项迁移而来，Name 为原配置项
+	SourceMigration = "migration"
+)
+
+// Source 配置项取值的来源
+type Source struct {
+	Path string `json:"path" yaml:"path"`
+	From string `json:"from" yaml:"from"`
+	Name string `json:"name" yaml:"name"` // 环境变量名、文件路径、启动参数或规则包
+}
+
+// Hash 返回加载时配置文件内容的 SHA-256，格式为 sha256:<hex>
+func (c *Config) Hash() string {
+	return c.hash
+}
+
+// Sources 返回取值不是直接来自配置文件的配置项及其来源
+func (c *Config) Sources() []Source {
+	return c.sources
+}
+
+// SetSource 记录配置项取值的来源，同一配置项只保留最后一次记录
+func (c *Config) SetSource(path, from, name string) {
+	for i := range c.sources {
+		if c.sources[i].Path == path {
+			c.sources[i] = Source{Path: path, From: from, Name: name}
+			return
+		}
+	}
+	c.sources = append(c.sources, Source{Path: path, From: from, Name: name})
+}
+
+// recordSources 记录加载过程中的来源：环境变量引用、include 引入的文件和规则包
+func (c *Config) recordSources(data []byte, envSources []Source, origins []metricTypeOrigin) {
+	sum := sha256.Sum256(data)
+	c.hash = "sha256:" + hex.EncodeToString(sum[:])
+
+	for _, source := range envSources {
+		c.SetSource(source.Path, source.From, source.Name)
+	}
+	for i, o := range origins {
+		path := fmt.Sprintf("metric_types[%d]", i)
+		if o.file != "" {
+			c.setOriginSource(path, o.origin)
+		}
+		// 覆盖规则包的指标来自配置文件，与指标类型的来源不同
+		for j, metric := range o.metrics {
+			if metric.file != o.file {
+				c.setOriginSource(fmt.Sprintf("%s.metrics[%d]", path, j), metric)
+			}
+		}
+	}
+}
+
+// setOriginSource 记录来自规则包或配置文件的配置项，文件来源包含行号
+func (c *Config) setOriginSource(path string, o origin) {
+	if strings.HasPrefix(o.file, packOriginPrefix) {
+		c.SetSource(path, SourcePack, strings.TrimPrefix(o.file, packOriginPrefix))
+		return
+	}
+	c.SetSource(path, SourceFile, o.describe())
+}
+
+// maskedKeys 取值需要隐藏的配置项名称
+var maskedKeys = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"secret":        true,
+	"token":         true,
+	"bearer_token":  true,
+}
+
+// Masked 返回隐藏了密码、密钥和令牌的完整配置，保持配置文件中的字段顺序
+// webhook 等URL中的令牌参数和密码由 redact 统一处理
+func (c *Config) Masked() (yaml.MapSlice, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling config: %w", err)
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	return maskValue(doc).(yaml.MapSlice), nil
+}
+
+// maskValue 递归隐藏敏感配置项
+func maskValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for i, item := range v {
+			if key, ok := item.Key.(string); ok && maskedKeys[key] {
+				if s, ok := item.Value.(string); ok && s != "" {
+					v[i].Value = redact.Mask
+					continue
+				}
+			}
+			v[i].Value = maskValue(item.Value)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = maskValue(v[i])
+		}
+		return v
+	case string:
+		return redact.String(v)
+	default:
+		return v
+	}
+}
+
+// ToJSONValue 将 yaml.MapSlice 转换为可以编码为 JSON 对象的 map
+func ToJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			m[fmt.Sprint(item.Key)] = ToJSONValue(item.Value)
+		}
+		return m
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = ToJSONValue(v[i])
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// metricFile include 引入的指标文件，只允许包含 metric_types
+type metricFile struct {
+	MetricTypes []MetricType `yaml:"metric_types"`
+}
+
+// origin 配置项在来源文件中的位置，用于检测重名和定位错误
+type origin struct {
+	file  string         // 来源文件，主配置文件为空
+	path  string         // 在来源文件中的路径，如 metric_types[1]
+	lines map[string]int // 来源文件中配置项的行号
+}
+
+// describe 返回用于错误信息的来源位置
+func (o origin) describe() string {
+	file := o.file
+	if file == "" {
+		file = "main config"
+	}
+	if line := lookupLine(o.lines, o.path); line > 0 {
+		return fmt.Sprintf("%s:%d", file, line)
+	}
+	return file
+}
+
+// metricTypeOrigin 合并后指标类型的来源
+type metricTypeOrigin struct {
+	origin
+	// metrics 每个指标的来源，覆盖规则包中的指标后与指标类型的来源不同；为空时与指标类型相同
+	metrics []origin
+}
+
+// IncludeFiles 展开 include 中的文件和通配符，返回当前匹配的全部文件，忽略无效的配置
+// 配置热加载通过它检查引入的文件是否变化
+func IncludeFiles(configPath string, patterns []string) []string {
+	files, _ := includeFiles(filepath.Dir(configPath), patterns)
+	return files
+}
+
+// includeFiles 按顺序展开 include，相对路径相对于 dir，同一通配符匹配的文件按文件名排序，重复的文件只引入一次
+// 通配符没有匹配到文件时忽略，不含通配符的文件不存在时返回错误
+func includeFiles(dir string, patterns []string) ([]string, []FieldError) {
+	var files []string
+	var errs []FieldError
+	seen := make(map[string]bool)
+	for i, pattern := range patterns {
+		path := fmt.Sprintf("include[%d]", i)
+		if strings.TrimSpace(pattern) == "" {
+			errs = append(errs, FieldError{Path: path, Message: "include path must not be empty"})
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf("invalid pattern %q: %v", pattern, err)})
+			continue
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf("file %s not found", pattern)})
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, errs
+}
+
+// mergeIncludes 按顺序加载 include 引入的指标文件，将其中的指标类型追加到 metric_types 之后
+// 返回每个指标类型的来源，与 metric_types 一一对应；与已有指标类型重名的不会合并，并返回错误
+func (c *Config) mergeIncludes(dir string, lines map[string]int) ([]metricTypeOrigin, []FieldError) {
+	origins := make([]metricTypeOrigin, len(c.MetricTypes))
+	defined := make(map[string]int)
+	for i, mt := range c.MetricTypes {
+		origins[i] = metricTypeOrigin{origin: origin{path: fmt.Sprintf("metric_types[%d]", i), lines: lines}}
+		if _, exists := defined[mt.Type]; !exists {
+			defined[mt.Type] = i
+		}
+	}
+
+	files, errs := includeFiles(dir, c.Include)
+	for i := range errs {
+		errs[i].Line = lookupLine(lines, errs[i].Path)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, FieldError{File: file, Message: fmt.Sprintf("reading included file: %v", err)})
+			continue
+		}
+		var mf metricFile
+		fileErrs, ok := decode(data, &mf)
+		fileLines := lineIndex(data)
+		for _, fe := range fileErrs {
+			if fe.Line == 0 {
+				fe.Line = lookupLine(fileLines, fe.Path)
+			}
+			fe.File = file
+			errs = append(errs, fe)
+		}
+		if !ok {
+			continue
+		}
+
+		for j, mt := range mf.MetricTypes {
+			typeOrigin := metricTypeOrigin{origin: origin{file: file, path: fmt.Sprintf("metric_types[%d]", j), lines: fileLines}}
+			if first, exists := defined[mt.Type]; exists && mt.Type != "" {
+				path := fmt.Sprintf("metric_types[%d].type", j)
+				errs = append(errs, FieldError{File: file, Line: lookupLine(fileLines, path), Path: path,
+					Message: fmt.Sprintf("duplicate metric type %q (also defined at %s)", mt.Type, origins[first].describe())})
+				continue
+			}
+			defined[mt.Type] = len(c.MetricTypes)
+			c.MetricTypes = append(c.MetricTypes, mt)
+			origins = append(origins, typeOrigin)
+		}
+	}
+	return origins, errs
+}
+
+// locate 将合并后 metric_types 中配置项的错误转换为来源文件中的路径和行号
+func locate(fe FieldError, origins []metricTypeOrigin, lines map[string]int) FieldError {
+	var typeIndex, metricIndex int
+	n, _ := fmt.Sscanf(fe.Path, "metric_types[%d].metrics[%d]", &typeIndex, &metricIndex)
+	if n == 0 || typeIndex >= len(origins) {
+		if fe.Line == 0 {
+			fe.Line = lookupLine(lines, fe.Path)
+		}
+		return fe
+	}
+
+	prefix := fmt.Sprintf("metric_types[%d]", typeIndex)
+	o := origins[typeIndex].origin
+	if metrics := origins[typeIndex].metrics; n == 2 && metricIndex < len(metrics) {
+		prefix = fmt.Sprintf("metric_types[%d].metrics[%d]", typeIndex, metricIndex)
+		o = metrics[metricIndex]
+	}
+	fe.File = o.file
+	fe.Path = o.path + strings.TrimPrefix(fe.Path, prefix)
+	fe.Line = lookupLine(o.lines, fe.Path)
+	return fe
+}
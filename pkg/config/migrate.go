@@ -0,0 +1,477 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// CurrentVersion 当前的配置文件格式版本，未设置 version 的配置文件按版本 1 读取
+//
+// 版本 2 相对版本 1 的变化：
+//   - 指标的 threshold_status 由 healthy_when_met 代替：normal 对应 healthy_when_met: true，critical 为默认值，直接去掉
+//   - notifications 下各渠道的 report_url 合并为 server.external_url
+const CurrentVersion = 2
+
+// migrateCommand 升级配置文件的命令，用于警告和错误信息
+const migrateCommand = "promai config migrate"
+
+// Warnings 返回加载时的废弃警告，旧版本的配置项已在内存中升级到 CurrentVersion
+func (c *Config) Warnings() []FieldError {
+	return c.warnings
+}
+
+// migrate 将旧版本的配置在内存中升级到 CurrentVersion，返回每个被迁移配置项的警告
+// 在合并 include 和规则包之后执行，origins 用于定位 include 引入文件中的指标
+func (c *Config) migrate(origins []metricTypeOrigin, lines map[string]int) []FieldError {
+	if c.Version < 0 || c.Version >= CurrentVersion {
+		return nil
+	}
+
+	var warnings []FieldError
+	if c.Version == 0 {
+		warnings = append(warnings, FieldError{
+			Message: fmt.Sprintf("version is not set, the config is read as version 1; run %q to upgrade it to version %d", migrateCommand, CurrentVersion),
+		})
+	} else {
+		warnings = append(warnings, FieldError{
+			Path: "version", Line: lookupLine(lines, "version"),
+			Message: fmt.Sprintf("config version %d is deprecated; run %q to upgrade it to version %d", c.Version, migrateCommand, CurrentVersion),
+		})
+	}
+	migrateMetricTypes(c.MetricTypes, func(path, message string) {
+		warnings = append(warnings, locate(FieldError{Path: path, Message: message}, origins, lines))
+	})
+	warnings = append(warnings, c.migrateReportURLs(lines)...)
+	c.Version = CurrentVersion
+	return warnings
+}
+
+// migrateMetricTypes 迁移指标中版本 1 的 threshold_status，每迁移一项调用一次 warn，warn 为 nil 时不提示
+func migrateMetricTypes(types []MetricType, warn func(path, message string)) {
+	for i := range types {
+		for j := range types[i].Metrics {
+			if message, ok := migrateMetric(&types[i].Metrics[j]); ok && warn != nil {
+				warn(fmt.Sprintf("metric_types[%d].metrics[%d].threshold_status", i, j), message)
+			}
+		}
+	}
+}
+
+// migrateMetric 将 threshold_status 转换为 healthy_when_met，返回迁移说明
+// 没有 threshold_status 或取值未知时不修改，未知取值由校验报告
+func migrateMetric(metric *MetricConfig) (string, bool) {
+	var message string
+	switch metric.ThresholdStatus {
+	case "normal":
+		metric.HealthyWhenMet = true
+		message = "threshold_status is deprecated, threshold_status: normal is read as healthy_when_met: true"
+	case "critical":
+		metric.HealthyWhenMet = false
+		message = "threshold_status is deprecated, threshold_status: critical is the default and can be removed"
+	default:
+		return "", false
+	}
+	metric.ThresholdStatus = ""
+	return message, true
+}
+
+// migrateReportURLs 将各通知渠道的 report_url 合并为 server.external_url
+// 版本 1 中 external_url 优先于 report_url，已配置 external_url 时 report_url 不生效
+func (c *Config) migrateReportURLs(lines map[string]int) []FieldError {
+	channels := []struct {
+		path string
+		url  *string
+	}{
+		{"notifications.dingtalk.report_url", &c.Notifications.Dingtalk.ReportURL},
+		{"notifications.email.report_url", &c.Notifications.Email.ReportURL},
+		{"notifications.wechat_work.report_url", &c.Notifications.WeChatWork.ReportURL},
+	}
+
+	var warnings []FieldError
+	for _, channel := range channels {
+		if *channel.url == "" {
+			continue
+		}
+		var message string
+		switch {
+		case c.Server.ExternalURL == "":
+			c.Server.ExternalURL = *channel.url
+			c.SetSource("server.external_url", SourceMigration, channel.path)
+			message = "report_url is deprecated, it is read as server.external_url and used for all report links"
+		case sameURL(c.Server.ExternalURL, *channel.url):
+			message = "report_url is deprecated and duplicates server.external_url, it can be removed"
+		default:
+			message = "report_url is deprecated and ignored, report links use server.external_url"
+		}
+		*channel.url = ""
+		warnings = append(warnings, FieldError{Path: channel.path, Line: lookupLine(lines, channel.path), Message: message})
+	}
+	return warnings
+}
+
+// sameURL 忽略末尾的 "/" 比较两个地址
+func sameURL(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// FileMigration 升级一个文件需要的修改，Changes 逐项说明修改的配置项，Data 为升级后的内容
+type FileMigration struct {
+	File    string
+	Changes []FieldError
+	Data    []byte
+}
+
+// Write 写入升级后的内容，backup 为 true 时先将原文件保存为 <文件名>.bak
+func (m FileMigration) Write(backup bool) error {
+	if backup {
+		original, err := os.ReadFile(m.File)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", m.File, err)
+		}
+		if err := writeFileAtomic(m.File+".bak", original); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(m.File, m.Data)
+}
+
+// MigrateFiles 将配置文件及其 include 引入的指标文件、overlay 文件升级到 CurrentVersion，只返回需要修改的文件，不写入
+// 按行修改，注释、空行和其他配置项保持原样；配置文件排在最后，按顺序写入时热加载不会读到不一致的配置
+// 无法自动修改的配置项（如 flow 风格的映射）以 *ValidationError 返回
+func MigrateFiles(path string) ([]FileMigration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	root, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, value := mappingEntry(root, "version"); value != nil {
+		version, err := strconv.Atoi(value.Value)
+		if err != nil || version < 1 || version > CurrentVersion {
+			return nil, fmt.Errorf("unsupported config version %q (this build supports 1 to %d)", value.Value, CurrentVersion)
+		}
+	}
+
+	files, err := relatedFiles(path, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []FileMigration
+	var errs []FieldError
+	for _, file := range files {
+		fileData, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		fileRoot, err := parseDocument(fileData)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		editor := newFileEditor(file, fileData)
+		editor.migrateMetrics(fileRoot)
+		errs = append(errs, editor.errs...)
+		if migration, ok := editor.migration(); ok {
+			migrations = append(migrations, migration)
+		}
+	}
+
+	editor := newFileEditor(path, data)
+	editor.migrateMetrics(root)
+	editor.migrateReportURLs(root)
+	editor.setVersion(root)
+	errs = append(errs, editor.errs...)
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	if migration, ok := editor.migration(); ok {
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
+
+// relatedFiles 返回配置文件引入的指标文件和已存在的 overlay 文件
+func relatedFiles(path string, root *yamlv3.Node) ([]string, error) {
+	dir := filepath.Dir(path)
+	var files []string
+	if _, include := mappingEntry(root, "include"); include != nil {
+		var patterns []string
+		if err := include.Decode(&patterns); err != nil {
+			return nil, fmt.Errorf("include: %w", err)
+		}
+		matched, errs := includeFiles(dir, patterns)
+		if len(errs) > 0 {
+			return nil, &ValidationError{Errors: errs}
+		}
+		files = append(files, matched...)
+	}
+	if _, overlay := mappingEntry(root, "overlay_file"); overlay != nil && overlay.Value != "" {
+		overlayPath := overlay.Value
+		if !filepath.IsAbs(overlayPath) {
+			overlayPath = filepath.Join(dir, overlayPath)
+		}
+		if _, err := os.Stat(overlayPath); err == nil {
+			files = append(files, overlayPath)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("overlay_file: %w", err)
+		}
+	}
+	return files, nil
+}
+
+// parseDocument 解析 YAML 文件，返回顶层的映射节点
+func parseDocument(data []byte) (*yamlv3.Node, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode || len(doc.Content[0].Content) == 0 {
+		return nil, fmt.Errorf("top level must be a non-empty mapping")
+	}
+	if doc.Content[0].Style&yamlv3.FlowStyle != 0 {
+		return nil, fmt.Errorf("top level must not use flow style")
+	}
+	return doc.Content[0], nil
+}
+
+// mappingEntry 返回映射中 key 对应的键和值节点，node 不是映射或不存在该键时返回 nil
+func mappingEntry(node *yamlv3.Node, key string) (*yamlv3.Node, *yamlv3.Node) {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// fileEditor 按行修改 YAML 文件，未修改的行（包括注释和空行）保持原样
+type fileEditor struct {
+	file    string
+	lines   []string
+	edits   []lineEdit
+	changes []FieldError
+	errs    []FieldError
+}
+
+// lineEdit 将第 start 到 end 行（从 1 开始，包含 end）替换为 text，end 为 start-1 时在第 start 行之前插入
+type lineEdit struct {
+	start, end int
+	text       []string
+}
+
+func newFileEditor(file string, data []byte) *fileEditor {
+	return &fileEditor{file: file, lines: strings.Split(string(data), "\n")}
+}
+
+// change 记录一项修改
+func (e *fileEditor) change(line int, path, message string) {
+	e.changes = append(e.changes, FieldError{File: e.file, Line: line, Path: path, Message: message})
+}
+
+// fail 记录无法自动修改的配置项
+func (e *fileEditor) fail(line int, path, message string) {
+	e.errs = append(e.errs, FieldError{File: e.file, Line: line, Path: path, Message: message})
+}
+
+// migration 按从后往前的顺序应用全部修改，没有修改时返回 false
+func (e *fileEditor) migration() (FileMigration, bool) {
+	if len(e.edits) == 0 {
+		return FileMigration{}, false
+	}
+	// 同一行先替换再插入，避免插入的行被替换
+	sort.SliceStable(e.edits, func(i, j int) bool {
+		if e.edits[i].start != e.edits[j].start {
+			return e.edits[i].start > e.edits[j].start
+		}
+		return e.edits[i].end > e.edits[j].end
+	})
+	lines := append([]string(nil), e.lines...)
+	for _, edit := range e.edits {
+		rest := append(append([]string(nil), edit.text...), lines[edit.end:]...)
+		lines = append(lines[:edit.start-1], rest...)
+	}
+	sort.SliceStable(e.changes, func(i, j int) bool { return e.changes[i].Line < e.changes[j].Line })
+	return FileMigration{File: e.file, Changes: e.changes, Data: []byte(strings.Join(lines, "\n"))}, true
+}
+
+// prefix 返回键所在行中键之前的内容，即缩进或序列项的 "- "
+func (e *fileEditor) prefix(key *yamlv3.Node) string {
+	line := e.lines[key.Line-1]
+	if key.Column-1 > len(line) {
+		return line
+	}
+	return line[:key.Column-1]
+}
+
+// editable 判断配置项是否可以按行修改：所在映射不是 flow 风格，取值不是多行文本
+func (e *fileEditor) editable(mapping, key, value *yamlv3.Node, path string) bool {
+	if mapping.Style&yamlv3.FlowStyle != 0 || value.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0 {
+		e.fail(key.Line, path, "cannot be rewritten automatically (flow style or multi-line value), edit it manually")
+		return false
+	}
+	return true
+}
+
+// replaceEntry 将配置项所在的行替换为 text，保留行尾注释
+func (e *fileEditor) replaceEntry(mapping, key, value *yamlv3.Node, path, text string) bool {
+	if !e.editable(mapping, key, value, path) {
+		return false
+	}
+	if comment := value.LineComment + key.LineComment; comment != "" {
+		text += " " + comment
+	}
+	e.edits = append(e.edits, lineEdit{start: key.Line, end: value.Line, text: []string{e.prefix(key) + text}})
+	return true
+}
+
+// removeEntry 删除映射中第 i 个键所在的行；键在序列项的 "- " 之后时由下一个键接上
+func (e *fileEditor) removeEntry(mapping *yamlv3.Node, i int, path string) bool {
+	key, value := mapping.Content[i], mapping.Content[i+1]
+	if !e.editable(mapping, key, value, path) {
+		return false
+	}
+	prefix := e.prefix(key)
+	if strings.TrimSpace(prefix) == "" {
+		e.edits = append(e.edits, lineEdit{start: key.Line, end: value.Line})
+		return true
+	}
+	if i+2 >= len(mapping.Content) || mapping.Content[i+2].Line != value.Line+1 || mapping.Content[i+2].Column != key.Column {
+		e.fail(key.Line, path, "cannot be removed automatically, edit it manually")
+		return false
+	}
+	next := mapping.Content[i+2]
+	e.edits = append(e.edits, lineEdit{start: key.Line, end: next.Line, text: []string{prefix + e.lines[next.Line-1][len(prefix):]}})
+	return true
+}
+
+// migrateMetrics 将 metric_types 下指标的 threshold_status 改为 healthy_when_met
+func (e *fileEditor) migrateMetrics(root *yamlv3.Node) {
+	_, types := mappingEntry(root, "metric_types")
+	if types == nil || types.Kind != yamlv3.SequenceNode {
+		return
+	}
+	for i, mt := range types.Content {
+		_, metrics := mappingEntry(mt, "metrics")
+		if metrics == nil || metrics.Kind != yamlv3.SequenceNode {
+			continue
+		}
+		for j, metric := range metrics.Content {
+			if metric.Kind != yamlv3.MappingNode {
+				continue
+			}
+			path := fmt.Sprintf("metric_types[%d].metrics[%d].threshold_status", i, j)
+			for k := 0; k+1 < len(metric.Content); k += 2 {
+				key, value := metric.Content[k], metric.Content[k+1]
+				if key.Value != "threshold_status" {
+					continue
+				}
+				switch value.Value {
+				case "normal":
+					if healthy, _ := mappingEntry(metric, "healthy_when_met"); healthy != nil {
+						e.fail(key.Line, path, "both threshold_status and healthy_when_met are set, edit it manually")
+					} else if e.replaceEntry(metric, key, value, path, "healthy_when_met: true") {
+						e.change(key.Line, path, "replaced threshold_status: normal with healthy_when_met: true")
+					}
+				case "critical":
+					if e.removeEntry(metric, k, path) {
+						e.change(key.Line, path, "removed threshold_status: critical (the default)")
+					}
+				default:
+					e.fail(key.Line, path, fmt.Sprintf("unknown value %q, edit it manually", value.Value))
+				}
+			}
+		}
+	}
+}
+
+// migrateReportURLs 删除各通知渠道的 report_url，server.external_url 为空时使用第一个 report_url
+func (e *fileEditor) migrateReportURLs(root *yamlv3.Node) {
+	_, notifications := mappingEntry(root, "notifications")
+	serverKey, server := mappingEntry(root, "server")
+	externalKey, external := mappingEntry(server, "external_url")
+	externalURL := ""
+	if external != nil {
+		externalURL = external.Value
+	}
+
+	moved := ""
+	for _, channel := range []string{"dingtalk", "email", "wechat_work"} {
+		_, settings := mappingEntry(notifications, channel)
+		if settings == nil {
+			continue
+		}
+		for k := 0; k+1 < len(settings.Content); k += 2 {
+			key, value := settings.Content[k], settings.Content[k+1]
+			path := "notifications." + channel + ".report_url"
+			if key.Value != "report_url" || !e.removeEntry(settings, k, path) {
+				continue
+			}
+			switch {
+			case value.Value == "":
+				e.change(key.Line, path, "removed empty report_url")
+			case externalURL == "":
+				externalURL, moved = value.Value, value.Value
+				e.change(key.Line, path, "moved to server.external_url")
+			case sameURL(externalURL, value.Value):
+				e.change(key.Line, path, "removed, same as server.external_url")
+			default:
+				e.change(key.Line, path, fmt.Sprintf("removed, report links use server.external_url %s", externalURL))
+			}
+		}
+	}
+	if moved == "" {
+		return
+	}
+
+	text := "external_url: " + strconv.Quote(moved)
+	switch {
+	case external != nil:
+		e.replaceEntry(server, externalKey, external, "server.external_url", text)
+	case server != nil && server.Kind == yamlv3.MappingNode && len(server.Content) > 0:
+		if server.Style&yamlv3.FlowStyle != 0 {
+			e.fail(serverKey.Line, "server", "cannot be rewritten automatically (flow style), add external_url manually")
+			return
+		}
+		first := server.Content[0]
+		e.edits = append(e.edits, lineEdit{start: first.Line, end: first.Line - 1, text: []string{strings.Repeat(" ", first.Column-1) + text}})
+	case serverKey != nil:
+		e.edits = append(e.edits, lineEdit{start: serverKey.Line + 1, end: serverKey.Line, text: []string{e.prefix(serverKey) + "  " + text}})
+	default:
+		// 追加到文件末尾，文件以换行结尾时插入在最后一个空行之前
+		end := len(e.lines)
+		if e.lines[end-1] != "" {
+			end++
+		}
+		e.edits = append(e.edits, lineEdit{start: end, end: end - 1, text: []string{"", "server:", "  " + text}})
+	}
+}
+
+// setVersion 将 version 设置为 CurrentVersion，没有 version 时添加在第一个配置项之前
+func (e *fileEditor) setVersion(root *yamlv3.Node) {
+	text := fmt.Sprintf("version: %d", CurrentVersion)
+	key, value := mappingEntry(root, "version")
+	if key == nil {
+		first := root.Content[0]
+		e.edits = append(e.edits, lineEdit{start: first.Line, end: first.Line - 1, text: []string{
+			"# 配置文件格式版本，旧版本的配置文件可以通过 " + migrateCommand + " 升级", text, "",
+		}})
+		e.change(first.Line, "version", fmt.Sprintf("set to %d", CurrentVersion))
+		return
+	}
+	if value.Value != strconv.Itoa(CurrentVersion) && e.replaceEntry(root, key, value, "version", text) {
+		e.change(key.Line, "version", fmt.Sprintf("changed from %s to %d", value.Value, CurrentVersion))
+	}
+}
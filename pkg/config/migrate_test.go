@@ -0,0 +1,245 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// v1Config 版本 1 的配置，包含全部需要迁移的配置项
+const v1Config = `# 巡检配置
+prometheus_url: "http://prometheus:9090"
+
+notifications:
+  dingtalk:
+    enabled: false
+    report_url: "http://promai.example.com"  # 报告地址
+  email:
+    enabled: false
+    report_url: "http://promai.example.com/"
+
+metric_types:
+  - type: "业务"
+    metrics:
+      - name: "up"
+        query: "up"
+        threshold: 1
+        threshold_type: "equal"
+        threshold_status: normal  # 等于 1 时正常
+        labels:
+          instance: "实例"
+      - threshold_status: critical
+        name: "down"
+        query: "up == 0"
+        threshold: 1
+        labels:
+          instance: "实例"
+`
+
+func TestParseMigratesVersion1(t *testing.T) {
+	cfg, err := Parse([]byte(v1Config))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.Version != CurrentVersion {
+		t.Fatalf("Version = %d, want %d", cfg.Version, CurrentVersion)
+	}
+	metrics := cfg.MetricTypes[0].Metrics
+	if !metrics[0].HealthyWhenMet || metrics[1].HealthyWhenMet || metrics[0].ThresholdStatus != "" || metrics[1].ThresholdStatus != "" {
+		t.Fatalf("migrated metrics = %+v, want healthy_when_met true/false without threshold_status", metrics)
+	}
+	if cfg.Server.ExternalURL != "http://promai.example.com" || cfg.Notifications.Dingtalk.ReportURL != "" || cfg.Notifications.Email.ReportURL != "" {
+		t.Fatalf("external_url = %q, report_url = %q/%q; want report_url moved", cfg.Server.ExternalURL, cfg.Notifications.Dingtalk.ReportURL, cfg.Notifications.Email.ReportURL)
+	}
+
+	wantWarnings := []struct {
+		path    string
+		message string
+	}{
+		{"", "version is not set"},
+		{"notifications.dingtalk.report_url", "read as server.external_url"},
+		{"notifications.email.report_url", "duplicates server.external_url"},
+		{"metric_types[0].metrics[0].threshold_status", "healthy_when_met: true"},
+		{"metric_types[0].metrics[1].threshold_status", "critical is the default"},
+	}
+	warnings := cfg.Warnings()
+	for _, want := range wantWarnings {
+		found := false
+		for _, w := range warnings {
+			if w.Path == want.path && strings.Contains(w.Message, want.message) && (w.Path == "" || w.Line > 0) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Warnings() = %v, want %s: %q with a line number", warnings, want.path, want.message)
+		}
+	}
+
+	found := false
+	for _, s := range cfg.Sources() {
+		found = found || s == Source{Path: "server.external_url", From: SourceMigration, Name: "notifications.dingtalk.report_url"}
+	}
+	if !found {
+		t.Fatalf("Sources() = %v, want server.external_url from migration", cfg.Sources())
+	}
+}
+
+func TestParseRejectsVersion1FieldsInVersion2(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		path string
+	}{
+		{
+			name: "threshold_status",
+			data: strings.Replace(minimalConfig, "threshold: 1\n", "threshold: 1\n        threshold_status: normal\n", 1),
+			path: "metric_types[0].metrics[0].threshold_status",
+		},
+		{
+			name: "report_url",
+			data: minimalConfig + "notifications:\n  email:\n    report_url: \"http://promai.example.com\"\n",
+			path: "notifications.email.report_url",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := parseErrors(t, "version: 2\n"+tt.data)
+			if len(errs) != 1 || errs[0].Path != tt.path || !strings.Contains(errs[0].Message, migrateCommand) {
+				t.Fatalf("Parse() errors = %v, want one error at %s pointing to %q", errs, tt.path, migrateCommand)
+			}
+		})
+	}
+}
+
+func TestMigrateFilesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		contains []string // 升级后的文件中应包含的内容
+	}{
+		{
+			name: "未设置版本",
+			data: v1Config,
+			contains: []string{
+				"version: 2\n",
+				"# 巡检配置",
+				`healthy_when_met: true # 等于 1 时正常`,
+				"      - name: \"down\"\n",
+				"server:\n  external_url: \"http://promai.example.com\"\n",
+			},
+		},
+		{
+			name: "已有 server 配置",
+			data: "version: 1\nserver:\n  base_path: \"/promai\"\n" + strings.TrimPrefix(v1Config, "# 巡检配置\n"),
+			contains: []string{
+				"version: 2\n",
+				"server:\n  external_url: \"http://promai.example.com\"\n  base_path: \"/promai\"\n",
+			},
+		},
+		{
+			name:     "只有指标需要迁移",
+			data:     strings.Replace(minimalConfig, "threshold: 1\n", "threshold: 1\n        threshold_status: critical\n", 1),
+			contains: []string{"version: 2\n", "        threshold: 1\n        labels:\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			migrations, err := MigrateFiles(path)
+			if err != nil {
+				t.Fatalf("MigrateFiles() error = %v", err)
+			}
+			if len(migrations) != 1 || migrations[0].File != path || len(migrations[0].Changes) == 0 {
+				t.Fatalf("MigrateFiles() = %+v, want one migration of %s", migrations, path)
+			}
+			if err := migrations[0].Write(true); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			if backup, err := os.ReadFile(path + ".bak"); err != nil || string(backup) != tt.data {
+				t.Fatalf("backup = %q, %v; want the original file", backup, err)
+			}
+			data, _ := os.ReadFile(path)
+			for _, want := range tt.contains {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("migrated file does not contain %q:\n%s", want, data)
+				}
+			}
+			if strings.Contains(string(data), "threshold_status") || strings.Contains(string(data), "report_url") {
+				t.Errorf("migrated file still contains version 1 fields:\n%s", data)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() after migration error = %v", err)
+			}
+			if warnings := cfg.Warnings(); len(warnings) != 0 {
+				t.Fatalf("Warnings() after migration = %v, want none", warnings)
+			}
+			if again, err := MigrateFiles(path); err != nil || len(again) != 0 {
+				t.Fatalf("second MigrateFiles() = %+v, %v; want nothing to migrate", again, err)
+			}
+		})
+	}
+}
+
+func TestMigrateFilesManualEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{
+			name: "flow 风格的指标",
+			data: strings.Replace(minimalConfig, "      - name: \"up\"\n", "      - {name: \"flow\", query: \"up\", threshold: 1, threshold_status: normal}\n      - name: \"up\"\n", 1),
+			err:  "flow style",
+		},
+		{
+			name: "同时设置两项",
+			data: strings.Replace(minimalConfig, "threshold: 1\n", "threshold: 1\n        threshold_status: normal\n        healthy_when_met: true\n", 1),
+			err:  "both threshold_status and healthy_when_met are set",
+		},
+		{
+			name: "未知取值",
+			data: strings.Replace(minimalConfig, "threshold: 1\n", "threshold: 1\n        threshold_status: warning\n", 1),
+			err:  `unknown value "warning"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			migrations, err := MigrateFiles(path)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 {
+				t.Fatalf("MigrateFiles() = %+v, %v; want one *ValidationError", migrations, err)
+			}
+			if fe := validationErr.Errors[0]; fe.File != path || fe.Line == 0 || !strings.Contains(fe.Message, tt.err) {
+				t.Fatalf("MigrateFiles() error = %+v, want %q in %s with a line number", fe, tt.err, path)
+			}
+			// 出错时不修改文件
+			if data, _ := os.ReadFile(path); string(data) != tt.data {
+				t.Fatalf("config file changed after failed migration:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestMigrateFilesUnsupportedVersion(t *testing.T) {
+	for _, version := range []string{"0", "3", "two"} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("version: "+version+"\n"+minimalConfig), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := MigrateFiles(path); err == nil || !strings.Contains(err.Error(), "unsupported config version") {
+			t.Errorf("MigrateFiles(version %s) error = %v, want unsupported config version", version, err)
+		}
+	}
+}
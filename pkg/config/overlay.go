@@ -0,0 +1,355 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Overlay 通过接口编辑的指标定义，保存在 overlay_file 中，与配置文件分开
+// 加载配置时在 include 和规则包之后应用：同名指标类型整体替换，其他指标类型追加在最后，
+// deleted_metric_types 中的指标类型被删除
+type Overlay struct {
+	MetricTypes []MetricType `yaml:"metric_types,omitempty" json:"metric_types"`
+	Deleted     []string     `yaml:"deleted_metric_types,omitempty" json:"deleted_metric_types"`
+}
+
+// overlayHeader 写入 overlay 文件开头的说明
+const overlayHeader = `# 由 PromAI 指标编辑接口维护，覆盖配置文件中的同名指标类型
+# 也可以手工修改，保存后自动重新加载
+`
+
+// LoadOverlay 读取 overlay 文件，文件不存在时返回空的 overlay
+func LoadOverlay(path string) (*Overlay, error) {
+	var overlay Overlay
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &overlay, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading overlay file: %w", err)
+	}
+	if errs, _ := decode(data, &overlay); len(errs) > 0 {
+		for i := range errs {
+			errs[i].File = path
+		}
+		return nil, &ValidationError{Errors: errs}
+	}
+	// 旧版本的字段在下次保存时按新格式写入
+	migrateMetricTypes(overlay.MetricTypes, nil)
+	return &overlay, nil
+}
+
+// Save 写入 overlay 文件，先写临时文件再重命名，避免热加载读到写了一半的文件
+func (o *Overlay) Save(path string) error {
+	data, err := yaml.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("marshaling overlay: %w", err)
+	}
+	return writeFileAtomic(path, append([]byte(overlayHeader), data...))
+}
+
+// OverlaySnapshot 修改前的 overlay 文件，重新加载配置失败时用于恢复
+type OverlaySnapshot struct {
+	path    string
+	data    []byte
+	existed bool
+}
+
+// SnapshotOverlay 记录 overlay 文件当前的内容，文件不存在时恢复即删除文件
+func SnapshotOverlay(path string) (*OverlaySnapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &OverlaySnapshot{path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading overlay file: %w", err)
+	}
+	return &OverlaySnapshot{path: path, data: data, existed: true}, nil
+}
+
+// Restore 将 overlay 文件恢复为记录时的内容，同样先写临时文件再重命名
+func (s *OverlaySnapshot) Restore() error {
+	if s.existed {
+		return writeFileAtomic(s.path, s.data)
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// writeFileAtomic 先写临时文件再重命名，文件已存在时保留其权限
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if info, err := os.Stat(path); err == nil {
+		tmp.Chmod(info.Mode().Perm())
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// SetMetricType 新增或替换同名的指标类型
+func (o *Overlay) SetMetricType(mt MetricType) {
+	o.Deleted = removeString(o.Deleted, mt.Type)
+	for i := range o.MetricTypes {
+		if o.MetricTypes[i].Type == mt.Type {
+			o.MetricTypes[i] = mt
+			return
+		}
+	}
+	o.MetricTypes = append(o.MetricTypes, mt)
+}
+
+// DeleteMetricType 删除指标类型，inBase 为 true 时记录到 deleted_metric_types，删除配置文件中的定义
+func (o *Overlay) DeleteMetricType(name string, inBase bool) {
+	for i := range o.MetricTypes {
+		if o.MetricTypes[i].Type == name {
+			o.MetricTypes = append(o.MetricTypes[:i], o.MetricTypes[i+1:]...)
+			break
+		}
+	}
+	if inBase && !contains(o.Deleted, name) {
+		o.Deleted = append(o.Deleted, name)
+	}
+}
+
+// Apply 返回在 base 上应用 overlay 后的指标类型，不修改 base
+func (o *Overlay) Apply(base []MetricType) []MetricType {
+	types, _ := o.apply(base)
+	return types
+}
+
+// appliedType 应用 overlay 后指标类型的来源，base 和 overlay 分别为在两者中的下标，不来自其中时为 -1
+type appliedType struct {
+	base, overlay int
+}
+
+// apply 应用 overlay，返回指标类型及每个指标类型的来源
+func (o *Overlay) apply(base []MetricType) ([]MetricType, []appliedType) {
+	replaced := make(map[string]int, len(o.MetricTypes))
+	for k, mt := range o.MetricTypes {
+		if _, exists := replaced[mt.Type]; !exists {
+			replaced[mt.Type] = k
+		}
+	}
+
+	var types []MetricType
+	var from []appliedType
+	used := make(map[int]bool)
+	for i, mt := range base {
+		if contains(o.Deleted, mt.Type) {
+			continue
+		}
+		if k, exists := replaced[mt.Type]; exists && !used[k] {
+			types = append(types, o.MetricTypes[k])
+			from = append(from, appliedType{base: i, overlay: k})
+			used[k] = true
+			continue
+		}
+		types = append(types, mt)
+		from = append(from, appliedType{base: i, overlay: -1})
+	}
+	for k, mt := range o.MetricTypes {
+		if !used[k] {
+			types = append(types, mt)
+			from = append(from, appliedType{base: -1, overlay: k})
+		}
+	}
+	return types, from
+}
+
+// applyOverlay 加载 overlay_file 并应用到 metric_types，返回每个指标类型的来源；overlay 文件不存在时不做修改
+func (c *Config) applyOverlay(dir string, origins []metricTypeOrigin) ([]metricTypeOrigin, []FieldError) {
+	c.base = c.MetricTypes
+	if c.OverlayFile == "" {
+		return origins, nil
+	}
+	c.overlayPath = c.OverlayFile
+	if !filepath.IsAbs(c.overlayPath) {
+		c.overlayPath = filepath.Join(dir, c.overlayPath)
+	}
+
+	data, err := os.ReadFile(c.overlayPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return origins, nil
+	}
+	if err != nil {
+		return origins, []FieldError{{File: c.overlayPath, Message: fmt.Sprintf("reading overlay file: %v", err)}}
+	}
+	var overlay Overlay
+	errs, ok := decode(data, &overlay)
+	overlayLines := lineIndex(data)
+	for i := range errs {
+		errs[i].File = c.overlayPath
+		if errs[i].Line == 0 {
+			errs[i].Line = lookupLine(overlayLines, errs[i].Path)
+		}
+	}
+	if !ok {
+		return origins, errs
+	}
+	// overlay 文件没有版本号，其中旧版本的字段总是迁移，下次通过接口编辑时按新格式保存
+	migrateMetricTypes(overlay.MetricTypes, func(path, message string) {
+		c.warnings = append(c.warnings, FieldError{File: c.overlayPath, Line: lookupLine(overlayLines, path), Path: path, Message: message})
+	})
+
+	types, from := overlay.apply(c.MetricTypes)
+	typeOrigins := make([]metricTypeOrigin, len(types))
+	for i, f := range from {
+		if f.overlay < 0 {
+			typeOrigins[i] = origins[f.base]
+			continue
+		}
+		typeOrigins[i] = metricTypeOrigin{
+			origin: origin{file: c.overlayPath, path: fmt.Sprintf("metric_types[%d]", f.overlay), lines: overlayLines},
+		}
+	}
+	c.MetricTypes = types
+	return typeOrigins, errs
+}
+
+// BaseMetricTypes 返回应用 overlay 之前的指标类型，即配置文件、include 和规则包中的定义
+func (c *Config) BaseMetricTypes() []MetricType {
+	return c.base
+}
+
+// OverlayPath 返回 overlay_file 的实际路径，未配置时为空
+func (c *Config) OverlayPath() string {
+	return c.overlayPath
+}
+
+// 指标类型和指标的变化
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// MetricTypeDiff 指标类型在 overlay 中的变化
+type MetricTypeDiff struct {
+	Type    string       `json:"type"`
+	Change  string       `json:"change"`
+	Metrics []MetricDiff `json:"metrics,omitempty"`
+}
+
+// MetricDiff 指标在 overlay 中的变化，修改时列出变化的字段
+type MetricDiff struct {
+	Name   string        `json:"name"`
+	Change string        `json:"change"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange 指标字段在配置文件和 overlay 中的取值
+type FieldChange struct {
+	Field   string      `json:"field"`
+	Base    interface{} `json:"base"`
+	Overlay interface{} `json:"overlay"`
+}
+
+// DiffMetricTypes 比较配置文件中的指标类型和应用 overlay 后的指标类型，按 effective 的顺序列出变化，删除的指标类型排在最后
+func DiffMetricTypes(base, effective []MetricType) []MetricTypeDiff {
+	diffs := []MetricTypeDiff{}
+	for _, mt := range effective {
+		baseType, exists := FindMetricType(base, mt.Type)
+		if !exists {
+			diffs = append(diffs, MetricTypeDiff{Type: mt.Type, Change: ChangeAdded, Metrics: diffMetrics(nil, mt.Metrics)})
+			continue
+		}
+		if metrics := diffMetrics(baseType.Metrics, mt.Metrics); len(metrics) > 0 {
+			diffs = append(diffs, MetricTypeDiff{Type: mt.Type, Change: ChangeModified, Metrics: metrics})
+		}
+	}
+	for _, mt := range base {
+		if _, exists := FindMetricType(effective, mt.Type); !exists {
+			diffs = append(diffs, MetricTypeDiff{Type: mt.Type, Change: ChangeRemoved, Metrics: diffMetrics(mt.Metrics, nil)})
+		}
+	}
+	return diffs
+}
+
+// diffMetrics 按名称比较同一指标类型下的指标
+func diffMetrics(base, effective []MetricConfig) []MetricDiff {
+	var diffs []MetricDiff
+	for _, metric := range effective {
+		index := FindMetric(base, metric.Name)
+		if index < 0 {
+			diffs = append(diffs, MetricDiff{Name: metric.Name, Change: ChangeAdded})
+			continue
+		}
+		if fields := diffFields(base[index], metric); len(fields) > 0 {
+			diffs = append(diffs, MetricDiff{Name: metric.Name, Change: ChangeModified, Fields: fields})
+		}
+	}
+	for _, metric := range base {
+		if FindMetric(effective, metric.Name) < 0 {
+			diffs = append(diffs, MetricDiff{Name: metric.Name, Change: ChangeRemoved})
+		}
+	}
+	return diffs
+}
+
+// diffFields 按 yaml 字段名列出取值不同的字段
+func diffFields(base, overlay MetricConfig) []FieldChange {
+	var fields []FieldChange
+	baseValue := reflect.ValueOf(base)
+	overlayValue := reflect.ValueOf(overlay)
+	for i := 0; i < baseValue.NumField(); i++ {
+		key, _, _ := strings.Cut(baseValue.Type().Field(i).Tag.Get("yaml"), ",")
+		b, o := baseValue.Field(i).Interface(), overlayValue.Field(i).Interface()
+		if !reflect.DeepEqual(b, o) {
+			fields = append(fields, FieldChange{Field: key, Base: b, Overlay: o})
+		}
+	}
+	return fields
+}
+
+// FindMetricType 按名称查找指标类型
+func FindMetricType(types []MetricType, name string) (MetricType, bool) {
+	for _, mt := range types {
+		if mt.Type == name {
+			return mt, true
+		}
+	}
+	return MetricType{}, false
+}
+
+// FindMetric 按名称查找指标，返回下标，不存在时返回 -1
+func FindMetric(metrics []MetricConfig, name string) int {
+	for i := range metrics {
+		if metrics[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeString 删除切片中等于 value 的元素
+func removeString(values []string, value string) []string {
+	var out []string
+	for _, v := range values {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
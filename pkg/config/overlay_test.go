@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverlaySnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "overlay.yaml")
+	original := []byte("metric_types: []\n")
+	if err := os.WriteFile(path, original, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := SnapshotOverlay(path)
+	if err != nil {
+		t.Fatalf("SnapshotOverlay() error = %v", err)
+	}
+	overlay := &Overlay{Deleted: []string{"业务"}}
+	if err := overlay.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := snapshot.Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != string(original) {
+		t.Fatalf("restored overlay = %q, %v; want %q", data, err, original)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Fatalf("restored overlay mode = %v, want 0600", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("temporary files left in %s: %v", dir, entries)
+	}
+}
+
+func TestOverlaySnapshotRestoreMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overlay.yaml")
+	snapshot, err := SnapshotOverlay(path)
+	if err != nil {
+		t.Fatalf("SnapshotOverlay() error = %v", err)
+	}
+	if err := (&Overlay{}).Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := snapshot.Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("overlay created by the edit still exists after Restore(): %v", err)
+	}
+	// 文件已被删除时再次恢复不报错
+	if err := snapshot.Restore(); err != nil {
+		t.Fatalf("second Restore() error = %v", err)
+	}
+}
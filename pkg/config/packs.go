@@ -0,0 +1,208 @@
+package config
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// packFiles 内置规则包，每个文件是一个规则包
+//
+//go:embed packs/*.yaml
+var packFiles embed.FS
+
+// packOriginPrefix 规则包中指标类型来源的前缀，后接 name@version
+const packOriginPrefix = "pack "
+
+// Pack 内置规则包：一组常用 exporter 的巡检指标，在配置文件中通过 packs 按名称引用
+type Pack struct {
+	Name        string       `yaml:"name"`
+	Version     string       `yaml:"version"`
+	Description string       `yaml:"description"`
+	MetricTypes []MetricType `yaml:"metric_types"`
+
+	lines map[string]int // 配置项在文件中的行号，用于定位错误
+}
+
+// Packs 返回全部内置规则包，按名称排序
+func Packs() ([]Pack, error) {
+	names, err := fs.Glob(packFiles, "packs/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	packs := make([]Pack, 0, len(names))
+	for _, name := range names {
+		pack, err := loadPack(name)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, *pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+	return packs, nil
+}
+
+// PackSource 返回内置规则包的 yaml 原文，用于查看可覆盖的指标类型和指标名称
+func PackSource(name string) ([]byte, error) {
+	data, err := packFiles.ReadFile(path.Join("packs", name+".yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown pack %q", name)
+	}
+	return data, nil
+}
+
+// loadPack 解析内置规则包文件
+func loadPack(file string) (*Pack, error) {
+	data, err := packFiles.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parsePack(file, data)
+}
+
+// parsePack 解析规则包内容
+func parsePack(file string, data []byte) (*Pack, error) {
+	var pack Pack
+	if errs, _ := decode(data, &pack); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", file, &ValidationError{Errors: errs})
+	}
+	pack.lines = lineIndex(data)
+	return &pack, nil
+}
+
+// lookupPack 按 packs 中的引用查找规则包，引用格式为 name 或 name@version，指定版本时需与内置版本一致
+func lookupPack(ref string) (*Pack, error) {
+	name, version, pinned := strings.Cut(ref, "@")
+	data, err := PackSource(name)
+	if err != nil {
+		packs, _ := Packs()
+		available := make([]string, len(packs))
+		for i, p := range packs {
+			available[i] = p.Name
+		}
+		return nil, fmt.Errorf("%w (available: %s)", err, strings.Join(available, ", "))
+	}
+	pack, err := parsePack(path.Join("packs", name+".yaml"), data)
+	if err != nil {
+		return nil, err
+	}
+	if pinned && version != pack.Version {
+		return nil, fmt.Errorf("pack %s version %s is not available (built-in version is %s)", name, version, pack.Version)
+	}
+	return pack, nil
+}
+
+// applyPacks 将 packs 引用的规则包放在 metric_types 之前；与规则包中指标类型同名的指标类型用于覆盖规则包：
+// 同名指标只覆盖显式配置的字段（如 threshold），其他指标追加到该类型之后
+func (c *Config) applyPacks(origins []metricTypeOrigin, lines map[string]int) ([]metricTypeOrigin, []FieldError) {
+	if len(c.Packs) == 0 {
+		return origins, nil
+	}
+
+	var errs []FieldError
+	var types []MetricType
+	var typeOrigins []metricTypeOrigin
+	packTypes := make(map[string]int) // 指标类型名称 -> types 中的下标
+	loaded := make(map[string]int)
+	for i, ref := range c.Packs {
+		path := fmt.Sprintf("packs[%d]", i)
+		pack, err := lookupPack(ref)
+		if err != nil {
+			errs = append(errs, FieldError{Path: path, Line: lookupLine(lines, path), Message: err.Error()})
+			continue
+		}
+		if first, exists := loaded[pack.Name]; exists {
+			errs = append(errs, FieldError{Path: path, Line: lookupLine(lines, path),
+				Message: fmt.Sprintf("pack %s is already included at packs[%d]", pack.Name, first)})
+			continue
+		}
+		loaded[pack.Name] = i
+
+		for j, mt := range pack.MetricTypes {
+			if _, exists := packTypes[mt.Type]; exists {
+				errs = append(errs, FieldError{Path: path, Line: lookupLine(lines, path),
+					Message: fmt.Sprintf("metric type %q of pack %s is already defined by another pack", mt.Type, pack.Name)})
+				continue
+			}
+			packTypes[mt.Type] = len(types)
+			types = append(types, mt)
+			typeOrigins = append(typeOrigins, metricTypeOrigin{
+				origin: origin{file: packOriginPrefix + pack.Name + "@" + pack.Version, path: fmt.Sprintf("metric_types[%d]", j), lines: pack.lines},
+			})
+		}
+	}
+
+	// 与规则包同名的指标类型合并到规则包中，其余的保持原有顺序放在规则包之后
+	var rest []MetricType
+	var restOrigins []metricTypeOrigin
+	for i, mt := range c.MetricTypes {
+		index, exists := packTypes[mt.Type]
+		if !exists {
+			rest = append(rest, mt)
+			restOrigins = append(restOrigins, origins[i])
+			continue
+		}
+		types[index], typeOrigins[index] = overridePackType(types[index], typeOrigins[index], mt, origins[i])
+	}
+	c.MetricTypes = append(types, rest...)
+	return append(typeOrigins, restOrigins...), errs
+}
+
+// overridePackType 用配置中的同名指标类型覆盖规则包中的指标类型，返回合并后的指标类型及每个指标的来源
+func overridePackType(pack MetricType, packOrigin metricTypeOrigin, override MetricType, overrideOrigin metricTypeOrigin) (MetricType, metricTypeOrigin) {
+	metrics := append([]MetricConfig(nil), pack.Metrics...)
+	metricOrigins := packOrigin.metrics
+	if metricOrigins == nil {
+		metricOrigins = make([]origin, len(metrics))
+		for j := range metrics {
+			metricOrigins[j] = packOrigin.origin
+			metricOrigins[j].path = fmt.Sprintf("%s.metrics[%d]", packOrigin.path, j)
+		}
+	}
+
+	for j, metric := range override.Metrics {
+		o := overrideOrigin.origin
+		o.path = fmt.Sprintf("%s.metrics[%d]", overrideOrigin.path, j)
+		if overrideOrigin.metrics != nil {
+			o = overrideOrigin.metrics[j]
+		}
+
+		index := -1
+		for k := range metrics {
+			if metrics[k].Name == metric.Name {
+				index = k
+				break
+			}
+		}
+		if index < 0 {
+			metrics = append(metrics, metric)
+			metricOrigins = append(metricOrigins, o)
+			continue
+		}
+		overrideMetric(&metrics[index], metric, func(key string) bool {
+			_, present := o.lines[o.path+"."+key]
+			return present
+		})
+		metricOrigins[index] = o
+	}
+
+	pack.Metrics = metrics
+	packOrigin.metrics = metricOrigins
+	return pack, packOrigin
+}
+
+// overrideMetric 用 override 中显式配置的字段覆盖 base，未配置的字段沿用规则包中的值
+func overrideMetric(base *MetricConfig, override MetricConfig, present func(key string) bool) {
+	baseValue := reflect.ValueOf(base).Elem()
+	overrideValue := reflect.ValueOf(override)
+	for i := 0; i < baseValue.NumField(); i++ {
+		key, _, _ := strings.Cut(baseValue.Type().Field(i).Tag.Get("yaml"), ",")
+		if key != "" && present(key) {
+			baseValue.Field(i).Set(overrideValue.Field(i))
+		}
+	}
+}
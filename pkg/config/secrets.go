@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"PromAI/pkg/prometheus"
+)
+
+// envNamePattern 合法的环境变量名
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envField 支持 ${VAR} 引用环境变量的配置项
+type envField struct {
+	path  string
+	value *string
+}
+
+// envFields 返回支持引用环境变量的配置项：数据源和通知渠道的地址与凭据、*_file 路径、对外地址和认证令牌
+// 指标定义不做替换，PromQL 中的 ${1}（如 label_replace 的捕获组）保持原样
+func (c *Config) envFields() []envField {
+	n := &c.Notifications
+	fields := []envField{
+		{"prometheus_url", &c.PrometheusURL},
+		{"notifications.dingtalk.webhook", &n.Dingtalk.Webhook},
+		{"notifications.dingtalk.webhook_file", &n.Dingtalk.WebhookFile},
+		{"notifications.dingtalk.secret", &n.Dingtalk.Secret},
+		{"notifications.dingtalk.secret_file", &n.Dingtalk.SecretFile},
+		{"notifications.email.smtp_host", &n.Email.SMTPHost},
+		{"notifications.email.username", &n.Email.Username},
+		{"notifications.email.password", &n.Email.Password},
+		{"notifications.email.password_file", &n.Email.PasswordFile},
+		{"notifications.wechat_work.webhook", &n.WeChatWork.Webhook},
+		{"notifications.wechat_work.webhook_file", &n.WeChatWork.WebhookFile},
+		{"notifications.wechat_work.proxy_url", &n.WeChatWork.ProxyURL},
+		{"server.external_url", &c.Server.ExternalURL},
+	}
+	fields = append(fields, authEnvFields("prometheus_auth", &c.PrometheusAuth)...)
+	for i := range c.DataSources {
+		path := fmt.Sprintf("data_sources[%d]", i)
+		fields = append(fields, envField{path + ".url", &c.DataSources[i].URL})
+		fields = append(fields, authEnvFields(path, &c.DataSources[i].Auth)...)
+	}
+	for i := range c.Auth.Tokens {
+		fields = append(fields, envField{fmt.Sprintf("auth.tokens[%d].token", i), &c.Auth.Tokens[i].Token})
+	}
+	for i := range c.Auth.BasicUsers {
+		fields = append(fields, envField{fmt.Sprintf("auth.basic_users[%d].password_hash", i), &c.Auth.BasicUsers[i].PasswordHash})
+	}
+	return fields
+}
+
+// authEnvFields 返回数据源认证中支持引用环境变量的配置项
+func authEnvFields(path string, auth *prometheus.Auth) []envField {
+	return []envField{
+		{path + ".basic_auth.username", &auth.BasicAuth.Username},
+		{path + ".basic_auth.password", &auth.BasicAuth.Password},
+		{path + ".basic_auth.password_file", &auth.BasicAuth.PasswordFile},
+		{path + ".bearer_token", &auth.BearerToken},
+		{path + ".bearer_token_file", &auth.BearerTokenFile},
+	}
+}
+
+// expandEnv 替换 envFields 中的 ${VAR} 和 ${VAR:-default}，返回引用了环境变量的配置项及每个无法替换的配置项
+// 在解析之后替换，注释中的引用不受影响，替换后的值不会被当作 yaml 再次解析
+func expandEnv(c *Config) ([]Source, []FieldError) {
+	var sources []Source
+	var errs []FieldError
+	for _, field := range c.envFields() {
+		value, vars, err := expandString(*field.value)
+		if err != nil {
+			errs = append(errs, FieldError{Path: field.path, Message: err.Error()})
+			continue
+		}
+		if len(vars) > 0 {
+			sources = append(sources, Source{Path: field.path, From: SourceEnv, Name: strings.Join(vars, ",")})
+		}
+		*field.value = value
+	}
+	return sources, errs
+}
+
+// expandString 替换 ${VAR} 和 ${VAR:-default}，返回替换后的值和引用的变量名
+// 变量未设置或为空时使用默认值，未设置且没有默认值时返回错误；$${ 表示字面量 ${，其他 $ 原样保留（如 PromQL 正则中的 $）
+func expandString(s string) (string, []string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil, nil
+	}
+
+	var b strings.Builder
+	var vars []string
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), vars, nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated variable reference %q", s[i:])
+		}
+		name, fallback, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+		if !envNamePattern.MatchString(name) {
+			return "", nil, fmt.Errorf("invalid environment variable name %q in %q", name, s[i:i+end+1])
+		}
+		value, set := os.LookupEnv(name)
+		switch {
+		case value == "" && hasDefault:
+			value = fallback
+		case !set:
+			return "", nil, fmt.Errorf("environment variable %s is not set (use ${%s:-default} to provide a default)", name, name)
+		}
+		vars = append(vars, name)
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// secretFile 支持从文件读取的敏感配置项
+type secretFile struct {
+	path  string  // 取值的配置项路径，文件路径配置项为 path + "_file"
+	value *string // 读取文件后写入的取值
+	file  string
+}
+
+// secretFiles 返回全部支持 *_file 的敏感配置项
+func (c *Config) secretFiles() []secretFile {
+	n := &c.Notifications
+	files := []secretFile{
+		{"notifications.dingtalk.webhook", &n.Dingtalk.Webhook, n.Dingtalk.WebhookFile},
+		{"notifications.dingtalk.secret", &n.Dingtalk.Secret, n.Dingtalk.SecretFile},
+		{"notifications.email.password", &n.Email.Password, n.Email.PasswordFile},
+		{"notifications.wechat_work.webhook", &n.WeChatWork.Webhook, n.WeChatWork.WebhookFile},
+	}
+	files = append(files, authSecretFiles("prometheus_auth", &c.PrometheusAuth)...)
+	for i := range c.DataSources {
+		files = append(files, authSecretFiles(fmt.Sprintf("data_sources[%d]", i), &c.DataSources[i].Auth)...)
+	}
+	return files
+}
+
+// authSecretFiles 返回数据源认证中的密码和令牌配置项
+func authSecretFiles(path string, auth *prometheus.Auth) []secretFile {
+	return []secretFile{
+		{path + ".basic_auth.password", &auth.BasicAuth.Password, auth.BasicAuth.PasswordFile},
+		{path + ".bearer_token", &auth.BearerToken, auth.BearerTokenFile},
+	}
+}
+
+// resolveSecretFiles 读取 *_file 指定的文件作为对应配置项的值，去掉末尾换行
+// 同时配置取值和文件、文件无法读取或为空时返回错误
+func resolveSecretFiles(c *Config) []FieldError {
+	var errs []FieldError
+	for _, secret := range c.secretFiles() {
+		if secret.file == "" {
+			continue
+		}
+		filePath := secret.path + "_file"
+		if *secret.value != "" {
+			errs = append(errs, FieldError{Path: filePath, Message: fmt.Sprintf("%s and %s are mutually exclusive",
+				lastSegment(secret.path), lastSegment(filePath))})
+			continue
+		}
+		data, err := os.ReadFile(secret.file)
+		if err != nil {
+			errs = append(errs, FieldError{Path: filePath, Message: fmt.Sprintf("reading secret file: %v", err)})
+			continue
+		}
+		value := strings.TrimRight(string(data), "\r\n")
+		if value == "" {
+			errs = append(errs, FieldError{Path: filePath, Message: fmt.Sprintf("secret file %s is empty", secret.file)})
+			continue
+		}
+		*secret.value = value
+		c.SetSource(secret.path, SourceFile, secret.file)
+	}
+	return errs
+}
+
+// joinPath 拼接配置项路径
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// lastSegment 返回配置项路径的最后一段，如 notifications.email.password 返回 password
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, ".")+1:]
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandEnvSkipsMetricDefinitions(t *testing.T) {
+	t.Setenv("PROMAI_TEST_PASSWORD", "s3cret")
+	query := `label_replace(up, "host", "${1}", "instance", "(.*):.*")`
+	data := strings.Replace(minimalConfig, `query: "up"`, "query: '"+query+"'", 1)
+	data = strings.Replace(data, `instance: "实例"`, `instance: "实例 ${1}"`, 1)
+	data += "notifications:\n  email:\n    password: \"${PROMAI_TEST_PASSWORD}\"\n"
+
+	cfg, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	metric := cfg.MetricTypes[0].Metrics[0]
+	if metric.Query != query {
+		t.Fatalf("query = %q, want %q unchanged", metric.Query, query)
+	}
+	if metric.Labels["instance"] != "实例 ${1}" {
+		t.Fatalf("labels.instance = %q, want it unchanged", metric.Labels["instance"])
+	}
+	if cfg.Notifications.Email.Password != "s3cret" {
+		t.Fatalf("notifications.email.password = %q, want the environment variable", cfg.Notifications.Email.Password)
+	}
+}
+
+func TestExpandString(t *testing.T) {
+	t.Setenv("PROMAI_TEST_HOST", "prometheus:9090")
+	t.Setenv("PROMAI_TEST_EMPTY", "")
+	tests := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "http://${PROMAI_TEST_HOST}/", want: "http://prometheus:9090/"},
+		{in: "${PROMAI_TEST_UNSET:-default}", want: "default"},
+		{in: "${PROMAI_TEST_EMPTY:-default}", want: "default"},
+		{in: "$${PROMAI_TEST_HOST}", want: "${PROMAI_TEST_HOST}"},
+		{in: "pa$$word", want: "pa$$word"},
+		{in: "${PROMAI_TEST_UNSET}", err: "PROMAI_TEST_UNSET is not set"},
+		{in: "${1}", err: `invalid environment variable name "1"`},
+		{in: "${PROMAI_TEST_HOST", err: "unterminated variable reference"},
+	}
+	for _, tt := range tests {
+		got, _, err := expandString(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expandString(%q) error = %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandString(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+// Select 返回仅包含选中指标的配置副本，enabled 为 false 的指标总是被去掉
+// types 为空时不按指标类型筛选，tags 为空时不按标签筛选，指标带有任一指定标签即被选中；
+// 筛选后没有指标的指标类型被去掉
+func (c *Config) Select(types, tags []string) *Config {
+	selected := *c
+	selected.MetricTypes = nil
+	for _, mt := range c.MetricTypes {
+		if len(types) > 0 && !contains(types, mt.Type) {
+			continue
+		}
+		var metrics []MetricConfig
+		for _, metric := range mt.Metrics {
+			if metric.IsEnabled() && hasAnyTag(metric, tags) {
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) > 0 {
+			selected.MetricTypes = append(selected.MetricTypes, MetricType{Type: mt.Type, Metrics: metrics})
+		}
+	}
+	return &selected
+}
+
+// hasAnyTag 指标是否带有 tags 中的任一标签，tags 为空时返回 true
+func hasAnyTag(metric MetricConfig, tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range metric.Tags {
+		if contains(tags, tag) {
+			return true
+		}
+	}
+	return false
+}
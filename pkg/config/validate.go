@@ -0,0 +1,510 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"PromAI/pkg/auth"
+	"PromAI/pkg/logging"
+	"PromAI/pkg/prometheus"
+	"PromAI/pkg/server"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ThresholdTypes threshold_type 可选值，为空时按 greater 处理
+var ThresholdTypes = []string{"greater", "greater_equal", "less", "less_equal", "equal", "not_equal"}
+
+func init() {
+	// PromAI 不执行查询，实验性函数和语法是否可用由目标 Prometheus 的 --enable-feature 决定，这里都按合法处理
+	parser.EnableExperimentalFunctions = true
+	parser.ExperimentalDurationExpr = true
+	parser.EnableExtendedRangeSelectors = true
+}
+
+// Severities severity 可选值
+var Severities = []string{"critical", "warning", "info"}
+
+// FieldError 单个配置项的错误，Line 为配置项在文件中的行号，无法定位时为 0
+// File 为 include 引入的文件，错误位于主配置文件时为空
+type FieldError struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File + ": ")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// ValidationError 配置文件中发现的全部错误，按行号排序
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fe.Error()
+	}
+	return fmt.Sprintf("%d config error(s):\n  %s", len(e.Errors), strings.Join(messages, "\n  "))
+}
+
+// yamlLinePattern 匹配 yaml 错误信息中的行号
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Load 读取并严格解析配置文件，include 中的相对路径相对于配置文件所在目录
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return parse(data, filepath.Dir(path))
+}
+
+// Parse 严格解析配置文件内容：未知字段、类型错误、环境变量和密钥文件错误以及语义错误都会以 *ValidationError 返回
+// include 中的相对路径相对于当前目录
+func Parse(data []byte) (*Config, error) {
+	return parse(data, ".")
+}
+
+// parse 解析配置文件并合并 include 引入的指标文件，引入文件中的错误带有 File
+func parse(data []byte, dir string) (*Config, error) {
+	var config Config
+	errs, ok := decode(data, &config)
+	if !ok {
+		// 语法错误时无法继续校验
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	// 先替换环境变量、读取 *_file 指定的文件，再校验替换后的取值
+	envSources, envErrs := expandEnv(&config)
+	errs = append(errs, envErrs...)
+	errs = append(errs, resolveSecretFiles(&config)...)
+
+	lines := lineIndex(data)
+	for i := range errs {
+		if errs[i].Line == 0 {
+			errs[i].Line = lookupLine(lines, errs[i].Path)
+		}
+	}
+
+	origins, includeErrs := config.mergeIncludes(dir, lines)
+	errs = append(errs, includeErrs...)
+	envErrs = append(envErrs, includeErrs...)
+	origins, packErrs := config.applyPacks(origins, lines)
+	errs = append(errs, packErrs...)
+	config.warnings = config.migrate(origins, lines)
+	origins, overlayErrs := config.applyOverlay(dir, origins)
+	errs = append(errs, overlayErrs...)
+
+	for _, fe := range config.Validate() {
+		fe = locate(fe, origins, lines)
+		// 环境变量未替换的配置项只报告一次
+		if !hasError(envErrs, fe.File, fe.Path) {
+			errs = append(errs, fe)
+		}
+	}
+	if len(errs) == 0 {
+		config.recordSources(data, envSources, origins)
+		return &config, nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return errs[i].File < errs[j].File
+		}
+		return errs[i].Line < errs[j].Line
+	})
+	return nil, &ValidationError{Errors: errs}
+}
+
+// decode 严格解析 yaml，返回未知字段和类型错误；存在语法错误时 ok 为 false，无法继续校验
+func decode(data []byte, out interface{}) (errs []FieldError, ok bool) {
+	err := yaml.UnmarshalStrict(data, out)
+	if err == nil {
+		return nil, true
+	}
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return []FieldError{yamlFieldError(err.Error())}, false
+	}
+	for _, msg := range typeErr.Errors {
+		errs = append(errs, yamlFieldError(msg))
+	}
+	return errs, true
+}
+
+// hasError 判断 errs 中是否已有该文件中该配置项的错误
+func hasError(errs []FieldError, file, path string) bool {
+	for _, fe := range errs {
+		if fe.File == file && fe.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlFieldError 将 yaml 解析错误转换为带行号的 FieldError
+func yamlFieldError(msg string) FieldError {
+	if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return FieldError{Line: line, Message: m[2]}
+	}
+	return FieldError{Message: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// Validate 检查配置的取值是否合法，返回全部错误
+func (c *Config) Validate() []FieldError {
+	var errs []FieldError
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Version < 0 || c.Version > CurrentVersion {
+		add("version", "unsupported config version %d (this build supports 1 to %d)", c.Version, CurrentVersion)
+	}
+	if c.PrometheusURL != "" {
+		if err := validateHTTPURL(c.PrometheusURL); err != nil {
+			add("prometheus_url", "%v", err)
+		}
+	}
+
+	datasourceNames := make(map[string]int)
+	for i, ds := range c.DataSources {
+		path := fmt.Sprintf("data_sources[%d]", i)
+		switch {
+		case ds.Name == "":
+			add(path+".name", "datasource name is required")
+		case strings.HasPrefix(ds.Name, "http://") || strings.HasPrefix(ds.Name, "https://"):
+			add(path+".name", "datasource name must not be a URL")
+		default:
+			if first, exists := datasourceNames[ds.Name]; exists {
+				add(path+".name", "duplicate datasource name %q (also defined at data_sources[%d])", ds.Name, first)
+			} else {
+				datasourceNames[ds.Name] = i
+			}
+		}
+		if err := validateHTTPURL(ds.URL); err != nil {
+			add(path+".url", "%v", err)
+		}
+		errs = append(errs, validateDatasourceAuth(path, ds.Auth)...)
+	}
+	errs = append(errs, validateDatasourceAuth("prometheus_auth", c.PrometheusAuth)...)
+	if _, err := prometheus.NewURLPolicy(c.DatasourcePolicy); err != nil {
+		errs = append(errs, sectionError("datasource_policy", err))
+	}
+
+	if len(c.MetricTypes) == 0 {
+		add("metric_types", "at least one metric type is required")
+	}
+	metricTypes := make(map[string]int)
+	for i, mt := range c.MetricTypes {
+		path := fmt.Sprintf("metric_types[%d]", i)
+		if mt.Type == "" {
+			add(path+".type", "metric type is required")
+		} else if first, exists := metricTypes[mt.Type]; exists {
+			add(path+".type", "duplicate metric type %q (also defined at metric_types[%d])", mt.Type, first)
+		} else {
+			metricTypes[mt.Type] = i
+		}
+		if len(mt.Metrics) == 0 {
+			add(path+".metrics", "at least one metric is required")
+		}
+		metricNames := make(map[string]int)
+		for j, metric := range mt.Metrics {
+			errs = append(errs, validateMetric(fmt.Sprintf("%s.metrics[%d]", path, j), metric, metricNames, j)...)
+		}
+	}
+
+	if c.CronSchedule != "" {
+		if _, err := cron.ParseStandard(c.CronSchedule); err != nil {
+			add("cron_schedule", "invalid cron expression %q: %v", c.CronSchedule, err)
+		}
+	}
+	for i, tag := range c.ScheduleTags {
+		if err := validateTag(tag); err != nil {
+			add(fmt.Sprintf("schedule_tags[%d]", i), "%v", err)
+		}
+	}
+	if len(c.ScheduleTags) > 0 && len(c.Select(nil, c.ScheduleTags).MetricTypes) == 0 {
+		add("schedule_tags", "no enabled metric has any of the tags %s", strings.Join(c.ScheduleTags, ", "))
+	}
+	if c.ScheduleRetry.MaxAttempts < 0 {
+		add("schedule_retry.max_attempts", "must not be negative")
+	}
+	if c.ScheduleRetry.Interval < 0 {
+		add("schedule_retry.interval", "must not be negative")
+	} else if c.ScheduleRetry.MaxAttempts > 0 && c.ScheduleRetry.Interval == 0 {
+		// 立即重试不能给数据源恢复的时间
+		add("schedule_retry.interval", "must be greater than 0 when max_attempts is set")
+	}
+	if c.ReportCleanup.Enabled && c.ReportCleanup.MaxAge <= 0 {
+		add("report_cleanup.max_age", "must be greater than 0 when report cleanup is enabled")
+	}
+	if c.ReportCleanup.CronSchedule != "" {
+		if _, err := cron.ParseStandard(c.ReportCleanup.CronSchedule); err != nil {
+			add("report_cleanup.cron_schedule", "invalid cron expression %q: %v", c.ReportCleanup.CronSchedule, err)
+		}
+	}
+
+	for _, channel := range []struct{ path, reportURL string }{
+		{"notifications.dingtalk.report_url", c.Notifications.Dingtalk.ReportURL},
+		{"notifications.email.report_url", c.Notifications.Email.ReportURL},
+		{"notifications.wechat_work.report_url", c.Notifications.WeChatWork.ReportURL},
+	} {
+		if channel.reportURL != "" {
+			add(channel.path, "report_url was replaced by server.external_url in config version %d; run %q", CurrentVersion, migrateCommand)
+		}
+	}
+	if dingtalk := c.Notifications.Dingtalk; dingtalk.Enabled {
+		if err := validateHTTPURL(dingtalk.Webhook); err != nil {
+			add("notifications.dingtalk.webhook", "%v", err)
+		}
+	}
+	if email := c.Notifications.Email; email.Enabled {
+		if email.SMTPHost == "" {
+			add("notifications.email.smtp_host", "smtp_host is required when email is enabled")
+		}
+		if email.SMTPPort <= 0 || email.SMTPPort > 65535 {
+			add("notifications.email.smtp_port", "invalid port %d", email.SMTPPort)
+		}
+		if _, err := mail.ParseAddress(email.From); err != nil {
+			add("notifications.email.from", "invalid sender address %q: %v", email.From, err)
+		}
+		if len(email.To) == 0 {
+			add("notifications.email.to", "at least one recipient is required when email is enabled")
+		}
+		for i, to := range email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				add(fmt.Sprintf("notifications.email.to[%d]", i), "invalid recipient address %q: %v", to, err)
+			}
+		}
+	}
+	if wechat := c.Notifications.WeChatWork; wechat.Enabled {
+		if err := validateHTTPURL(wechat.Webhook); err != nil {
+			add("notifications.wechat_work.webhook", "%v", err)
+		}
+		if wechat.ProxyURL != "" {
+			if u, err := url.Parse(wechat.ProxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+				add("notifications.wechat_work.proxy_url", "invalid proxy URL %q", wechat.ProxyURL)
+			}
+		}
+	}
+
+	if _, err := server.NormalizeBasePath(c.Server.BasePath); err != nil {
+		errs = append(errs, sectionError("server.base_path", err))
+	}
+	if _, err := server.NormalizeExternalURL(c.Server.ExternalURL); err != nil {
+		errs = append(errs, sectionError("server.external_url", err))
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		add("server.tls", "cert_file and key_file must be set together")
+	}
+	if c.ShutdownGracePeriod < 0 {
+		add("shutdown_grace_period", "must not be negative")
+	}
+	if _, err := auth.New(c.Auth); err != nil {
+		errs = append(errs, sectionError("auth", err))
+	}
+	if _, err := logging.NewHandler(io.Discard, c.Log); err != nil {
+		errs = append(errs, sectionError("log", err))
+	}
+	if c.Health.Timeout < 0 {
+		add("health.timeout", "must not be negative")
+	}
+	return errs
+}
+
+// sectionError 转换各模块返回的配置错误，这些错误信息以配置项路径开头（如 "auth.tokens[0] (ci): ..."），
+// 提取出路径用于定位行号，否则使用 section 作为路径
+func sectionError(section string, err error) FieldError {
+	head, msg, ok := strings.Cut(err.Error(), ": ")
+	if !ok || !strings.HasPrefix(head, section) {
+		return FieldError{Path: section, Message: err.Error()}
+	}
+	path, name, named := strings.Cut(head, " (")
+	if named {
+		msg = strings.TrimSuffix(name, ")") + ": " + msg
+	}
+	return FieldError{Path: path, Message: msg}
+}
+
+// ValidateMetric 检查单个指标定义，规则与配置文件中的指标相同，错误路径为指标下的字段名（如 query）
+func ValidateMetric(metric MetricConfig) []FieldError {
+	errs := validateMetric("", metric, make(map[string]int), 0)
+	for i := range errs {
+		errs[i].Path = strings.TrimPrefix(errs[i].Path, ".")
+	}
+	return errs
+}
+
+// validateMetric 检查单个指标配置，seen 记录同一指标类型下已出现的指标名称
+func validateMetric(path string, metric MetricConfig, seen map[string]int, index int) []FieldError {
+	var errs []FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Path: path + field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if metric.Name == "" {
+		add(".name", "metric name is required")
+	} else if first, exists := seen[metric.Name]; exists {
+		add(".name", "duplicate metric name %q (also defined at metrics[%d])", metric.Name, first)
+	} else {
+		seen[metric.Name] = index
+	}
+	if strings.TrimSpace(metric.Query) == "" {
+		add(".query", "query is required")
+	} else if _, err := parser.ParseExpr(metric.Query); err != nil {
+		add(".query", "invalid PromQL: %v", err)
+	}
+	if metric.ThresholdType != "" && !contains(ThresholdTypes, metric.ThresholdType) {
+		add(".threshold_type", "unknown value %q (expected one of %s)", metric.ThresholdType, strings.Join(ThresholdTypes, ", "))
+	}
+	if metric.ThresholdStatus != "" {
+		add(".threshold_status", "threshold_status was replaced by healthy_when_met in config version %d (normal is healthy_when_met: true, critical is the default); run %q", CurrentVersion, migrateCommand)
+	}
+	if metric.Severity != "" && !contains(Severities, metric.Severity) {
+		add(".severity", "unknown value %q (expected one of %s)", metric.Severity, strings.Join(Severities, ", "))
+	}
+	if metric.RunbookURL != "" {
+		if err := validateHTTPURL(metric.RunbookURL); err != nil {
+			add(".runbook_url", "%v", err)
+		}
+	}
+	for i, tag := range metric.Tags {
+		if err := validateTag(tag); err != nil {
+			add(fmt.Sprintf(".tags[%d]", i), "%v", err)
+		}
+	}
+	if len(metric.Labels) == 0 {
+		add(".labels", "at least one label is required")
+	}
+	for name, alias := range metric.Labels {
+		if name == "" || alias == "" {
+			add(".labels", "label name and display name must not be empty (got %q: %q)", name, alias)
+		}
+	}
+	return errs
+}
+
+// validateTag 检查指标标签，标签在查询参数中以逗号分隔，不能包含逗号和空白
+func validateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tag must not be empty")
+	}
+	if strings.ContainsAny(tag, ", \t\n") {
+		return fmt.Errorf("tag %q must not contain commas or whitespace", tag)
+	}
+	return nil
+}
+
+// validateDatasourceAuth 检查数据源认证配置，basic_auth 与 bearer_token 不能同时配置
+func validateDatasourceAuth(path string, a prometheus.Auth) []FieldError {
+	var errs []FieldError
+	if a.BasicAuth.Password != "" && a.BasicAuth.Username == "" {
+		errs = append(errs, FieldError{Path: path + ".basic_auth.username", Message: "username is required when password is set"})
+	}
+	if a.BearerToken != "" && a.BasicAuth.Username != "" {
+		errs = append(errs, FieldError{Path: path + ".bearer_token", Message: "basic_auth and bearer_token are mutually exclusive"})
+	}
+	return errs
+}
+
+// validateHTTPURL 检查是否为 http/https 地址
+func validateHTTPURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("URL is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q: expected http:// or https:// with a host", raw)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// lineIndex 记录每个配置项路径（如 metric_types[0].metrics[1].query）在文件中的行号
+func lineIndex(data []byte) map[string]int {
+	lines := make(map[string]int)
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return lines
+	}
+
+	var walk func(node *yamlv3.Node, path string)
+	walk = func(node *yamlv3.Node, path string) {
+		switch node.Kind {
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				child := key.Value
+				if path != "" {
+					child = path + "." + key.Value
+				}
+				lines[child] = key.Line
+				walk(value, child)
+			}
+		case yamlv3.SequenceNode:
+			for i, item := range node.Content {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				lines[child] = item.Line
+				walk(item, child)
+			}
+		case yamlv3.AliasNode:
+			walk(node.Alias, path)
+		}
+	}
+	walk(doc.Content[0], "")
+	return lines
+}
+
+// lookupLine 查找配置项的行号，配置项本身不在文件中（如缺失的必填项）时使用最近的上级配置项
+func lookupLine(lines map[string]int, path string) int {
+	for path != "" {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMetricQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string // 为空时查询应合法，否则为错误信息中应包含的内容
+	}{
+		{query: `up`},
+		{query: `up{job="node", instance=~"10\\..*"}`},
+		{query: `sum by (instance) (rate(node_cpu_seconds_total{mode!="idle"}[5m])) / ignoring(mode) group_left count(node_cpu_seconds_total)`},
+		{query: `histogram_quantile(0.99, sum by (le) (rate(http_request_duration_seconds_bucket[5m])))`},
+		{query: `max_over_time(up[1h:5m] @ end() offset 1d)`},
+		{query: `label_replace(up, "host", "$1", "instance", "(.*):.*")`},
+		{query: `topk(3, node_load1) > bool 2`},
+		// 实验性函数由目标 Prometheus 决定是否可用
+		{query: `first_over_time(up[5m])`},
+		{query: `ts_of_max_over_time(up[5m])`},
+		{query: `limitk(2, up)`},
+
+		{query: `sum(rate(up[5m])`, err: "unclosed left parenthesis"},
+		{query: `no_such_function(up)`, err: `unknown function with name "no_such_function"`},
+		{query: `rate(up[5x])`, err: "parse error"},
+		{query: `up{job=~"("}`, err: "error parsing regexp"},
+		{query: `rate(up)`, err: "expected type range vector"},
+		{query: `up +`, err: "unexpected end of input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			errs := validateMetric("", MetricConfig{Name: "m", Query: tt.query, Labels: map[string]string{"instance": "实例"}}, make(map[string]int), 0)
+			if tt.err == "" {
+				if len(errs) != 0 {
+					t.Fatalf("validateMetric() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Path != ".query" || !strings.Contains(errs[0].Message, tt.err) {
+				t.Fatalf("validateMetric() = %v, want one query error containing %q", errs, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateMetricQueryRequired(t *testing.T) {
+	errs := validateMetric("", MetricConfig{Name: "m", Query: "  ", Labels: map[string]string{"instance": "实例"}}, make(map[string]int), 0)
+	if len(errs) != 1 || errs[0].Path != ".query" || errs[0].Message != "query is required" {
+		t.Fatalf("validateMetric() = %v, want query is required", errs)
+	}
+}
+
+// minimalConfig 可以通过校验的最小配置
+const minimalConfig = `
+prometheus_url: "http://prometheus:9090"
+metric_types:
+  - type: "业务"
+    metrics:
+      - name: "up"
+        query: "up"
+        threshold: 1
+        labels:
+          instance: "实例"
+`
+
+// parseErrors 解析配置并返回校验错误，配置有效时返回 nil
+func parseErrors(t *testing.T, data string) []FieldError {
+	t.Helper()
+	_, err := Parse([]byte(data))
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Parse() error = %v, want *ValidationError", err)
+	}
+	return validationErr.Errors
+}
+
+func TestValidateScheduleRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry string
+		err   string // 为空时配置应有效，否则为 schedule_retry 下出错的字段
+	}{
+		{name: "不重试", retry: "max_attempts: 0\n  interval: 0"},
+		{name: "按间隔重试", retry: "max_attempts: 2\n  interval: 60"},
+		{name: "立即重试", retry: "max_attempts: 2\n  interval: 0", err: "schedule_retry.interval"},
+		{name: "未设置间隔", retry: "max_attempts: 1", err: "schedule_retry.interval"},
+		{name: "负数间隔", retry: "max_attempts: 0\n  interval: -1", err: "schedule_retry.interval"},
+		{name: "负数次数", retry: "max_attempts: -1\n  interval: 60", err: "schedule_retry.max_attempts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := parseErrors(t, minimalConfig+"schedule_retry:\n  "+tt.retry+"\n")
+			if tt.err == "" {
+				if errs != nil {
+					t.Fatalf("Parse() errors = %v, want none", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Path != tt.err || errs[0].Line == 0 {
+				t.Fatalf("Parse() errors = %v, want one error at %s with a line number", errs, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string // 追加到 minimalConfig 之后的配置
+		path  string // 为空时配置应有效，否则为出错的配置项
+		line  int    // 出错的行号，0 表示不检查
+	}{
+		{name: "最小配置", extra: ""},
+		{name: "当前版本", extra: "version: 2\n"},
+		{name: "不支持的版本", extra: "version: 3\n", path: "version", line: 11},
+		{name: "未知字段", extra: "promethues_url: \"http://p:9090\"\n", line: 11},
+		{name: "类型错误", extra: "shutdown_grace_period: soon\n", line: 11},
+		{name: "非法地址", extra: "data_sources:\n  - name: \"c1\"\n    url: \"prom:9090\"\n", path: "data_sources[0].url", line: 13},
+		{name: "数据源名称为URL", extra: "data_sources:\n  - name: \"http://c1\"\n    url: \"http://prom:9090\"\n", path: "data_sources[0].name", line: 12},
+		{name: "重复的数据源名称", extra: "data_sources:\n  - name: \"c1\"\n    url: \"http://a:9090\"\n  - name: \"c1\"\n    url: \"http://b:9090\"\n", path: "data_sources[1].name", line: 14},
+		{name: "非法 cron", extra: "cron_schedule: \"every day\"\n", path: "cron_schedule", line: 11},
+		{name: "证书缺少私钥", extra: "server:\n  tls:\n    cert_file: \"cert.pem\"\n", path: "server.tls"},
+		{name: "邮件缺少收件人", extra: "notifications:\n  email:\n    enabled: true\n    smtp_host: \"smtp\"\n    smtp_port: 25\n    from: \"promai@example.com\"\n", path: "notifications.email.to"},
+		{name: "未知的数据源策略", extra: "datasource_policy:\n  custom_urls: \"open\"\n", path: "datasource_policy.custom_urls", line: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := parseErrors(t, minimalConfig+tt.extra)
+			if tt.path == "" && tt.line == 0 {
+				if errs != nil {
+					t.Fatalf("Parse() errors = %v, want none", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Path != tt.path || (tt.line != 0 && errs[0].Line != tt.line) {
+				t.Fatalf("Parse() errors = %v, want one error at %q line %d", errs, tt.path, tt.line)
+			}
+		})
+	}
+}
+
+func TestValidateMetricTypes(t *testing.T) {
+	metric := "      - name: \"m\"\n        query: \"up\"\n        threshold: 1\n        labels:\n          instance: \"实例\"\n"
+	tests := []struct {
+		name string
+		data string
+		path string
+	}{
+		{name: "没有指标类型", data: "prometheus_url: \"http://p:9090\"\nmetric_types: []\n", path: "metric_types"},
+		{name: "缺少类型名称", data: "metric_types:\n  - metrics:\n" + metric, path: "metric_types[0].type"},
+		{name: "重复的类型", data: "metric_types:\n  - type: \"a\"\n    metrics:\n" + metric + "  - type: \"a\"\n    metrics:\n" + metric, path: "metric_types[1].type"},
+		{name: "没有指标", data: "metric_types:\n  - type: \"a\"\n    metrics: []\n", path: "metric_types[0].metrics"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := parseErrors(t, tt.data)
+			if len(errs) != 1 || errs[0].Path != tt.path {
+				t.Fatalf("Parse() errors = %v, want one error at %s", errs, tt.path)
+			}
+		})
+	}
+}
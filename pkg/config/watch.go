@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"PromAI/pkg/logging"
+)
+
+// WatchFiles 定期读取 files 返回的文件，文件列表或任一文件内容变化时调用 onChange，直到 ctx 结束
+// 按内容而不是修改时间判断，兼容 Kubernetes ConfigMap 通过替换符号链接更新文件的方式
+func WatchFiles(ctx context.Context, files func() []string, interval time.Duration, onChange func()) {
+	last, _ := filesHash(files())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sum, err := filesHash(files())
+		if err != nil {
+			// 更新过程中文件可能暂时不存在，下次再检查
+			slog.Debug("读取配置文件失败", logging.Err(err))
+			continue
+		}
+		if bytes.Equal(sum, last) {
+			continue
+		}
+		last = sum
+		slog.Info("检测到配置文件变化")
+		onChange()
+	}
+}
+
+// filesHash 计算文件列表及各文件内容的 SHA-256
+func filesHash(paths []string) ([]byte, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(h, path+"\x00")
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil), nil
+}
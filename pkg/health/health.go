@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"PromAI/pkg/redact"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// Config 就绪检查配置
+type Config struct {
+	CheckDatasources bool `yaml:"check_datasources"` // 是否检查每个数据源的 buildinfo 接口
+	Timeout          int  `yaml:"timeout"`           // 单次检查超时（秒），默认 5
+}
+
+// 检查结果状态
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc 单项检查，返回 nil 表示通过
+type CheckFunc func(ctx context.Context) error
+
+// Check 命名的检查项
+type Check struct {
+	Name string
+	Func CheckFunc
+}
+
+// Result 单项检查结果
+type Result struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Report 就绪检查汇总
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Run 并发执行全部检查，每项检查受 timeout 限制
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check, timeout)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+			break
+		}
+	}
+	return report
+}
+
+// runCheck 执行单项检查，超时后不再等待检查返回
+func runCheck(ctx context.Context, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Func(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := Result{Name: check.Name, Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = redact.String(err.Error())
+	}
+	return result
+}
+
+// LivenessHandler 进程存活检查，始终返回 200
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+	}
+}
+
+// ReadinessHandler 就绪检查，全部检查通过返回 200，否则返回 503 及每项检查的结果
+func ReadinessHandler(checks func() []Check, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := Run(r.Context(), checks(), timeout)
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	}
+}
+
+// TemplatesParse 检查模板文件能否解析，funcs 为模板中使用的自定义函数
+func TemplatesParse(files []string, funcs template.FuncMap) CheckFunc {
+	return func(ctx context.Context) error {
+		for _, file := range files {
+			if _, err := template.New(filepath.Base(file)).Funcs(funcs).ParseFiles(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// DirWritable 检查目录存在且可以创建文件
+func DirWritable(dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		file, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		name := file.Name()
+		file.Close()
+		return os.Remove(name)
+	}
+}
+
+// PrometheusBuildinfo 检查 Prometheus 数据源的 buildinfo 接口能否访问
+func PrometheusBuildinfo(api v1.API) CheckFunc {
+	return func(ctx context.Context) error {
+		_, err := api.Buildinfo(ctx)
+		return err
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"PromAI/pkg/redact"
+)
+
+// Config 日志配置
+type Config struct {
+	Level  string `yaml:"level"`  // debug、info（默认）、warn、error
+	Format string `yaml:"format"` // text（默认）、json
+}
+
+// 统一的日志属性名，便于在日志系统中按任务、数据源、指标和通知渠道检索
+const (
+	KeyTaskID     = "task_id"
+	KeyDatasource = "datasource"
+	KeyMetric     = "metric"
+	KeyMetricType = "metric_type"
+	KeyChannel    = "channel"
+	KeyError      = "error"
+	KeyMethod     = "method"
+	KeyPath       = "path"
+	KeyRemote     = "remote"
+	KeyUser       = "user"
+)
+
+// Err 返回统一命名的错误属性
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// Setup 按配置创建默认 slog 日志器，标准库 log 的输出也会经由该日志器以 info 级别输出
+// 所有字符串属性和消息都会经过脱敏处理
+func Setup(cfg Config) error {
+	handler, err := NewHandler(os.Stderr, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// NewHandler 创建写入 out 的日志处理器
+func NewHandler(out io.Writer, cfg Config) (slog.Handler, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}
+
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		return slog.NewTextHandler(out, opts), nil
+	case "json":
+		return slog.NewJSONHandler(out, opts), nil
+	default:
+		return nil, fmt.Errorf("log.format: unknown format %q (expected text or json)", cfg.Format)
+	}
+}
+
+// ParseLevel 解析日志级别，为空时返回 info
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("log.level: unknown level %q (expected debug, info, warn or error)", name)
+	}
+}
+
+// redactAttr 隐藏属性值中的敏感信息
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if s := a.Value.String(); s != "" {
+			a.Value = slog.StringValue(redact.String(s))
+		}
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(redact.String(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(redact.String(v.String()))
+		}
+	}
+	return a
+}
@@ -2,9 +2,10 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"math"
 	"time"
 
@@ -12,8 +13,11 @@ import (
 	"github.com/prometheus/common/model"
 
 	"PromAI/pkg/config"
+	"PromAI/pkg/logging"
 	"PromAI/pkg/prometheus"
+	"PromAI/pkg/redact"
 	"PromAI/pkg/report"
+	"PromAI/pkg/telemetry"
 )
 
 // Collector 处理指标收集
@@ -57,94 +61,168 @@ func (c *Collector) UpdatePrometheusURL(url string) error {
 	return nil
 }
 
-// CollectMetrics 收集指标数据
-func (c *Collector) CollectMetrics() (*report.ReportData, error) {
-	log.Printf("[DEBUG] 开始收集指标，使用数据源: %s", c.prometheusURL)
-	ctx := context.Background()
-
-	data := &report.ReportData{
+// NewReportData 创建空的报告数据，数据源为收集器当前使用的地址（隐藏其中的密码）
+func (c *Collector) NewReportData() *report.ReportData {
+	return &report.ReportData{
 		Timestamp:    time.Now(),
 		MetricGroups: make(map[string]*report.MetricGroup),
 		ChartData:    make(map[string]template.JS),
 		Project:      c.config.ProjectName,
-		Datasource:   c.prometheusURL, //在CollectMetrics函数开始时设置默认数据源
+		Datasource:   redact.String(c.prometheusURL),
 	}
+}
 
-	for _, metricType := range c.config.MetricTypes {
-		group := &report.MetricGroup{
-			Type:          metricType.Type,
-			MetricsByName: make(map[string][]report.MetricData),
+// CollectGroup 收集单个指标类型下的全部指标，状态需随后通过 EvaluateThresholds 计算
+// 每个指标查询结束后调用 onMetric，返回的错误列表对应查询失败的指标
+func (c *Collector) CollectGroup(ctx context.Context, metricType config.MetricType, onMetric func(metricName string, err error)) (*report.MetricGroup, []error) {
+	group := &report.MetricGroup{
+		Type:          metricType.Type,
+		MetricsByName: make(map[string][]report.MetricData),
+	}
+
+	var errs []error
+	for _, metric := range metricType.Metrics {
+		start := time.Now()
+		metrics, err := c.collectMetric(ctx, metric)
+		telemetry.ObserveQuery(metricType.Type, metric.Name, time.Since(start), err)
+		if err != nil {
+			slog.Warn("查询指标失败", logging.KeyMetricType, metricType.Type, logging.KeyMetric, metric.Name, logging.KeyDatasource, c.prometheusURL, logging.Err(err))
+			errs = append(errs, fmt.Errorf("%s: %w", metric.Name, err))
+		} else if metrics != nil {
+			group.MetricsByName[metric.Name] = metrics
+		}
+		if onMetric != nil {
+			onMetric(metric.Name, err)
 		}
-		data.MetricGroups[metricType.Type] = group
+	}
+	return group, errs
+}
 
-		for _, metric := range metricType.Metrics {
-			log.Printf("[DEBUG] 查询指标 %s, 查询语句: %s, 数据源: %s", metric.Name, metric.Query, c.prometheusURL)
-			result, _, err := c.Client.Query(ctx, metric.Query, time.Now())
-			if err != nil {
-				log.Printf("警告: 查询指标 %s 失败: %v", metric.Name, err)
-				continue
-			}
-			log.Printf("指标 [%s] 查询结果: %+v", metric.Name, result)
-
-			switch v := result.(type) {
-			case model.Vector:
-				metrics := make([]report.MetricData, 0, len(v))
-				for _, sample := range v {
-					log.Printf("指标 [%s] 原始数据: %+v, 值: %+v", metric.Name, sample.Metric, sample.Value)
-
-					availableLabels := make(map[string]string)
-					for labelName, labelValue := range sample.Metric {
-						availableLabels[string(labelName)] = string(labelValue)
-					}
-
-					labels := make([]report.LabelData, 0, len(metric.Labels))
-					for configLabel, configAlias := range metric.Labels {
-						labelValue := "-"
-						if rawValue, exists := availableLabels[configLabel]; exists && rawValue != "" {
-							labelValue = rawValue
-						} else {
-							log.Printf("警告: 指标 [%s] 标签 [%s] 缺失或为空", metric.Name, configLabel)
-						}
-
-						labels = append(labels, report.LabelData{
-							Name:  configLabel,
-							Alias: configAlias,
-							Value: labelValue,
-						})
-					}
-
-					value := float64(sample.Value)
-
-					// 检查值是否有效（非NaN且有限）
-					if math.IsNaN(value) || math.IsInf(value, 0) {
-						log.Printf("警告: 指标 [%s] 返回无效值 (NaN/Inf): %v, 跳过该条记录", metric.Name, value)
-						continue
-					}
-
-					metricData := report.MetricData{
-						Name:        metric.Name,
-						Description: metric.Description,
-						Value:       value,
-						Threshold:   metric.Threshold,
-						Unit:        metric.Unit,
-						Status:      getStatus(value, metric.Threshold, metric.ThresholdType, metric.ThresholdStatus),
-						StatusText:  report.GetStatusText(getStatus(value, metric.Threshold, metric.ThresholdType, metric.ThresholdStatus)),
-						Timestamp:   time.Now(),
-						Labels:      labels,
-					}
-
-					if err := validateMetricData(metricData, metric.Labels); err != nil {
-						log.Printf("警告: 指标 [%s] 数据验证失败: %v", metric.Name, err)
-						continue
-					}
-
-					metrics = append(metrics, metricData)
-				}
-				group.MetricsByName[metric.Name] = metrics
+// ErrInvalidQuery 数据源拒绝执行查询，如函数参数类型错误
+var ErrInvalidQuery = errors.New("query rejected by datasource")
+
+// CheckQuery 在数据源上执行一次即时查询，确认查询可以执行，返回数据源的警告
+// 查询语句错误时返回 ErrInvalidQuery，连接失败等其他错误原样返回
+func CheckQuery(ctx context.Context, client PrometheusAPI, query string) ([]string, error) {
+	_, warnings, err := client.Query(ctx, query, time.Now())
+	if rejected := rejectedQuery(err); rejected != nil {
+		return warnings, rejected
+	}
+	return warnings, err
+}
+
+// rejectedQuery 数据源因查询语句错误拒绝执行时返回包装了 ErrInvalidQuery 的错误，否则返回 nil
+func rejectedQuery(err error) error {
+	var apiErr *v1.Error
+	if errors.As(err, &apiErr) && apiErr.Type == v1.ErrBadData {
+		return fmt.Errorf("%w: %s", ErrInvalidQuery, apiErr.Msg)
+	}
+	return nil
+}
+
+// collectMetric 查询单个指标并按配置映射标签，非向量结果返回 nil
+func (c *Collector) collectMetric(ctx context.Context, metric config.MetricConfig) ([]report.MetricData, error) {
+	slog.Debug("查询指标", logging.KeyMetric, metric.Name, "query", metric.Query, logging.KeyDatasource, c.prometheusURL)
+	result, _, err := c.Client.Query(ctx, metric.Query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("指标查询完成", logging.KeyMetric, metric.Name, "result_type", result.Type().String())
+
+	metrics, _ := convertResult(metric, result)
+	return metrics, nil
+}
+
+// convertResult 按配置映射标签并校验每条记录，返回有效的记录及标签缺失、记录被跳过的原因，非向量结果返回 nil
+func convertResult(metric config.MetricConfig, result model.Value) ([]report.MetricData, []string) {
+	v, ok := result.(model.Vector)
+	if !ok {
+		return nil, []string{fmt.Sprintf("query returned %s instead of vector, result is ignored", result.Type())}
+	}
+
+	var warnings []string
+	metrics := make([]report.MetricData, 0, len(v))
+	for _, sample := range v {
+		availableLabels := make(map[string]string)
+		for labelName, labelValue := range sample.Metric {
+			availableLabels[string(labelName)] = string(labelValue)
+		}
+
+		labels := make([]report.LabelData, 0, len(metric.Labels))
+		for configLabel, configAlias := range metric.Labels {
+			labelValue := "-"
+			if rawValue, exists := availableLabels[configLabel]; exists && rawValue != "" {
+				labelValue = rawValue
+			} else {
+				slog.Debug("指标标签缺失或为空", logging.KeyMetric, metric.Name, "label", configLabel)
+				warnings = append(warnings, fmt.Sprintf("label %q is missing or empty, shown as \"-\"", configLabel))
 			}
+
+			labels = append(labels, report.LabelData{
+				Name:  configLabel,
+				Alias: configAlias,
+				Value: labelValue,
+			})
+		}
+
+		value := float64(sample.Value)
+
+		// 检查值是否有效（非NaN且有限）
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			slog.Warn("指标返回无效值 (NaN/Inf)，跳过该条记录", logging.KeyMetric, metric.Name, "value", value)
+			warnings = append(warnings, fmt.Sprintf("skipped a row with invalid value %v", value))
+			continue
+		}
+
+		metricData := report.MetricData{
+			Name:        metric.Name,
+			Description: metric.Description,
+			Value:       value,
+			Threshold:   metric.Threshold,
+			Unit:        metric.Unit,
+			Timestamp:   time.Now(),
+			Labels:      labels,
+			Owner:       metric.Owner,
+			RunbookURL:  metric.RunbookURL,
+			Severity:    metric.Severity,
+			Tags:        metric.Tags,
 		}
+
+		if err := validateMetricData(metricData, metric.Labels); err != nil {
+			slog.Warn("指标数据验证失败", logging.KeyMetric, metric.Name, logging.Err(err))
+			warnings = append(warnings, fmt.Sprintf("skipped a row that failed validation: %v", err))
+			continue
+		}
+
+		metrics = append(metrics, metricData)
+	}
+	return metrics, warnings
+}
+
+// EvaluateThresholds 根据配置的阈值计算每条指标数据的状态
+func (c *Collector) EvaluateThresholds(data *report.ReportData) {
+	for _, metricType := range c.config.MetricTypes {
+		group, exists := data.MetricGroups[metricType.Type]
+		if !exists {
+			continue
+		}
+		for _, metric := range metricType.Metrics {
+			evaluateThreshold(group.MetricsByName[metric.Name], metric)
+		}
+	}
+}
+
+// evaluateThreshold 根据指标的阈值配置计算每条记录的状态
+func evaluateThreshold(items []report.MetricData, metric config.MetricConfig) {
+	thresholdStatus := "critical"
+	if metric.HealthyWhenMet {
+		thresholdStatus = "normal"
+	}
+	for i := range items {
+		status := getStatus(items[i].Value, metric.Threshold, metric.ThresholdType, thresholdStatus)
+		items[i].Status = status
+		items[i].StatusText = report.GetStatusText(status)
 	}
-	return data, nil
 }
 
 // validateMetricData 验证指标数据的完整性
@@ -168,7 +246,7 @@ func validateMetricData(data report.MetricData, configLabels map[string]string)
 	return nil
 }
 
-// getStatus 获取状态 - 支持threshold_status配置
+// getStatus 获取状态，thresholdStatus 为满足阈值条件时的状态（healthy_when_met 时为 normal）
 func getStatus(value, threshold float64, thresholdType, thresholdStatus string) string {
 	if thresholdType == "" {
 		thresholdType = "greater"
@@ -190,6 +268,8 @@ func getStatus(value, threshold float64, thresholdType, thresholdStatus string)
 		triggered = value <= threshold
 	case "equal":
 		triggered = value == threshold
+	case "not_equal":
+		triggered = value != threshold
 	}
 
 	if triggered {
@@ -216,7 +296,7 @@ func getStatus(value, threshold float64, thresholdType, thresholdStatus string)
 		return "warning"
 	}
 
-	// 既未触发阈值也未接近阈值，根据threshold_status决定默认状态
+	// 既未触发阈值也未接近阈值，根据thresholdStatus决定默认状态
 	if thresholdStatus == "critical" {
 		return "normal"
 	} else {
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+
+	"PromAI/pkg/config"
+	"PromAI/pkg/report"
+)
+
+func TestEvaluateThreshold(t *testing.T) {
+	tests := []struct {
+		thresholdType  string
+		healthyWhenMet bool
+		threshold      float64
+		value          float64
+		want           string
+	}{
+		// 默认满足阈值条件为严重
+		{"greater", false, 80, 81, "critical"},
+		{"greater", false, 80, 80, "warning"},
+		{"greater", false, 80, 72, "warning"},
+		{"greater", false, 80, 50, "normal"},
+		{"", false, 80, 81, "critical"},
+		{"greater_equal", false, 80, 80, "critical"},
+		{"greater_equal", false, 80, 75, "warning"},
+		{"greater_equal", false, 80, 10, "normal"},
+		{"less", false, 3, 2, "critical"},
+		{"less", false, 3, 3, "normal"},
+		{"less", false, 3, 5, "normal"},
+		{"less_equal", false, 3, 3, "critical"},
+		{"less_equal", false, 3, 5, "normal"},
+		{"equal", false, 1, 1, "critical"},
+		{"equal", false, 1, 0.9, "warning"},
+		{"equal", false, 1, 0, "normal"},
+		{"not_equal", false, 1, 0, "critical"},
+		{"not_equal", false, 1, 0.99, "critical"},
+		{"not_equal", false, 1, 1, "normal"},
+
+		// healthy_when_met 时满足阈值条件为正常
+		{"greater", true, 10, 20, "normal"},
+		{"greater", true, 10, 9.5, "warning"},
+		{"greater", true, 10, 2, "critical"},
+		{"greater_equal", true, 10, 10, "normal"},
+		{"greater_equal", true, 10, 9, "warning"},
+		{"greater_equal", true, 10, 2, "critical"},
+		{"less", true, 100, 50, "normal"},
+		{"less", true, 100, 200, "critical"},
+		{"less_equal", true, 100, 100, "normal"},
+		{"less_equal", true, 100, 200, "critical"},
+		{"equal", true, 1, 1, "normal"},
+		{"equal", true, 1, 0.9, "warning"},
+		{"equal", true, 1, 0, "critical"},
+		{"not_equal", true, 1, 0, "normal"},
+		{"not_equal", true, 1, 2, "normal"},
+		{"not_equal", true, 1, 1, "critical"},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s/healthy_when_met=%t/%g vs %g", tt.thresholdType, tt.healthyWhenMet, tt.value, tt.threshold)
+		t.Run(name, func(t *testing.T) {
+			items := []report.MetricData{{Value: tt.value}}
+			evaluateThreshold(items, config.MetricConfig{
+				Threshold:      tt.threshold,
+				ThresholdType:  tt.thresholdType,
+				HealthyWhenMet: tt.healthyWhenMet,
+			})
+			if items[0].Status != tt.want {
+				t.Fatalf("status = %q, want %q", items[0].Status, tt.want)
+			}
+			if items[0].StatusText != report.GetStatusText(tt.want) {
+				t.Fatalf("status text = %q, want %q", items[0].StatusText, report.GetStatusText(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"PromAI/pkg/config"
+)
+
+// Preview 单个指标定义的试运行结果
+type Preview struct {
+	Metric     config.MetricConfig `json:"metric"`
+	ResultType string              `json:"resultType,omitempty"`
+	Rows       []PreviewRow        `json:"rows"`
+	// Summary 各状态的记录数
+	Summary  map[string]int `json:"summary"`
+	Warnings []string       `json:"warnings"`
+	// Error 数据源拒绝执行查询的原因，此时没有记录
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// PreviewRow 试运行得到的一条记录，与报告中的一行对应
+type PreviewRow struct {
+	Labels     []PreviewLabel `json:"labels"`
+	Value      float64        `json:"value"`
+	Status     string         `json:"status"`
+	StatusText string         `json:"statusText"`
+}
+
+// PreviewLabel 映射后的标签
+type PreviewLabel struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias"`
+	Value string `json:"value"`
+}
+
+// PreviewMetric 使用与巡检相同的查询、标签映射、数据校验和阈值逻辑试运行单个指标定义，不生成报告
+// 指标定义不符合配置规则时仍然执行查询，问题记录在 Warnings 中；数据源拒绝查询时记录在 Error 中，
+// 无法连接数据源等其他错误直接返回
+func PreviewMetric(ctx context.Context, client PrometheusAPI, metric config.MetricConfig) (*Preview, error) {
+	preview := &Preview{Metric: metric, Rows: []PreviewRow{}, Summary: map[string]int{}, Warnings: []string{}}
+	for _, fe := range config.ValidateMetric(metric) {
+		preview.Warnings = append(preview.Warnings, fe.Error())
+	}
+
+	start := time.Now()
+	result, warnings, err := client.Query(ctx, metric.Query, start)
+	preview.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	preview.Warnings = append(preview.Warnings, warnings...)
+	if rejected := rejectedQuery(err); rejected != nil {
+		preview.Error = rejected.Error()
+		return preview, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	preview.ResultType = result.Type().String()
+
+	items, issues := convertResult(metric, result)
+	preview.Warnings = append(preview.Warnings, countIssues(issues)...)
+	evaluateThreshold(items, metric)
+	for _, item := range items {
+		row := PreviewRow{Value: item.Value, Status: item.Status, StatusText: item.StatusText}
+		for _, label := range item.Labels {
+			row.Labels = append(row.Labels, PreviewLabel{Name: label.Name, Alias: label.Alias, Value: label.Value})
+		}
+		// 标签来自 map，按名称排序使输出稳定
+		sort.Slice(row.Labels, func(i, j int) bool { return row.Labels[i].Name < row.Labels[j].Name })
+		preview.Rows = append(preview.Rows, row)
+		preview.Summary[item.Status]++
+	}
+	return preview, nil
+}
+
+// countIssues 合并重复的问题，出现多次的附上次数
+func countIssues(issues []string) []string {
+	counts := make(map[string]int)
+	var order []string
+	for _, issue := range issues {
+		if counts[issue] == 0 {
+			order = append(order, issue)
+		}
+		counts[issue]++
+	}
+	out := make([]string, 0, len(order))
+	for _, issue := range order {
+		if counts[issue] > 1 {
+			issue = fmt.Sprintf("%s (%d rows)", issue, counts[issue])
+		}
+		out = append(out, issue)
+	}
+	return out
+}
@@ -9,45 +9,57 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/smtp"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"PromAI/pkg/logging"
+	"PromAI/pkg/redact"
 	"PromAI/pkg/report"
 	"PromAI/pkg/utils"
 
 	"github.com/jordan-wright/email"
 )
 
+// DingtalkConfig 钉钉通知配置，webhook_file、secret_file 从文件读取对应的值（如 Kubernetes Secret），加载配置时读取
 type DingtalkConfig struct {
-	Enabled   bool   `yaml:"enabled"`
-	Webhook   string `yaml:"webhook"`
-	Secret    string `yaml:"secret"`
-	ReportURL string `yaml:"report_url"`
+	Enabled     bool   `yaml:"enabled"`
+	Webhook     string `yaml:"webhook"`
+	WebhookFile string `yaml:"webhook_file"`
+	Secret      string `yaml:"secret"`
+	SecretFile  string `yaml:"secret_file"`
+	ReportURL   string `yaml:"report_url"` // 已废弃，请使用 server.external_url
 }
 
+// EmailConfig 邮件通知配置，password_file 从文件读取 SMTP 密码，加载配置时读取
 type EmailConfig struct {
-	Enabled   bool     `yaml:"enabled"`
-	SMTPHost  string   `yaml:"smtp_host"`
-	SMTPPort  int      `yaml:"smtp_port"`
-	Username  string   `yaml:"username"`
-	Password  string   `yaml:"password"`
-	From      string   `yaml:"from"`
-	To        []string `yaml:"to"`
-	ReportURL string   `yaml:"report_url"`
+	Enabled      bool     `yaml:"enabled"`
+	SMTPHost     string   `yaml:"smtp_host"`
+	SMTPPort     int      `yaml:"smtp_port"`
+	Username     string   `yaml:"username"`
+	Password     string   `yaml:"password"`
+	PasswordFile string   `yaml:"password_file"`
+	From         string   `yaml:"from"`
+	To           []string `yaml:"to"`
+	ReportURL    string   `yaml:"report_url"` // 已废弃，请使用 server.external_url
 }
 
+// WeChatWorkConfig 企业微信通知配置，webhook_file 从文件读取包含机器人 key 的 webhook，加载配置时读取
 type WeChatWorkConfig struct {
-	Enabled   bool   `yaml:"enabled"`
-	Webhook   string `yaml:"webhook"`
-	ProxyURL  string `yaml:"proxy_url"`
-	ReportURL string `yaml:"report_url"`
+	Enabled     bool   `yaml:"enabled"`
+	Webhook     string `yaml:"webhook"`
+	WebhookFile string `yaml:"webhook_file"`
+	ProxyURL    string `yaml:"proxy_url"`
+	ReportURL   string `yaml:"report_url"` // 已废弃，请使用 server.external_url
 }
 
 type AlertSummary struct {
@@ -56,8 +68,23 @@ type AlertSummary struct {
 	WarningAlerts  int
 	NormalMetrics  int
 	TotalMetrics   int
+	Issues         []AlertIssue // 存在异常记录的指标，按严重程度排序
 }
 
+// AlertIssue 存在异常记录的指标及其负责人、处理手册
+type AlertIssue struct {
+	Type       string
+	Name       string
+	Status     string // 异常记录中最严重的状态
+	Count      int    // 异常记录数
+	Severity   string
+	Owner      string
+	RunbookURL string
+}
+
+// maxAlertIssues 通知中最多列出的异常指标数，其余的在报告中查看
+const maxAlertIssues = 10
+
 type TypeAlertSummary struct {
 	Type          string
 	TotalMetrics  int
@@ -66,12 +93,13 @@ type TypeAlertSummary struct {
 	NormalCount   int
 }
 
-// calculateAlertSummary 从报告数据中计算告警汇总
+// CalculateAlertSummary 从报告数据中计算告警汇总，并列出存在异常记录的指标
 func CalculateAlertSummary(data report.ReportData) AlertSummary {
 	summary := AlertSummary{}
 
-	for _, group := range data.MetricGroups {
-		for _, metrics := range group.MetricsByName {
+	for typeName, group := range data.MetricGroups {
+		for name, metrics := range group.MetricsByName {
+			var issue *AlertIssue
 			for _, metric := range metrics {
 				summary.TotalMetrics++
 
@@ -84,14 +112,120 @@ func CalculateAlertSummary(data report.ReportData) AlertSummary {
 					summary.TotalAlerts++
 				default:
 					summary.NormalMetrics++
+					continue
 				}
+				if issue == nil {
+					issue = &AlertIssue{Type: typeName, Name: name, Status: metric.Status,
+						Severity: metric.Severity, Owner: metric.Owner, RunbookURL: metric.RunbookURL}
+				}
+				issue.Count++
+				if metric.Status == "critical" {
+					issue.Status = "critical"
+				}
+			}
+			if issue != nil {
+				summary.Issues = append(summary.Issues, *issue)
 			}
 		}
 	}
 
+	sort.Slice(summary.Issues, func(i, j int) bool {
+		a, b := summary.Issues[i], summary.Issues[j]
+		if issueRank(a) != issueRank(b) {
+			return issueRank(a) < issueRank(b)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
 	return summary
 }
 
+// issueRank 异常指标的排序权重，严重状态在前，同一状态下按 severity 排序
+func issueRank(issue AlertIssue) int {
+	rank := 0
+	if issue.Status != "critical" {
+		rank = 4
+	}
+	switch issue.Severity {
+	case "critical":
+	case "warning":
+		rank++
+	case "info":
+		rank += 2
+	default:
+		rank += 3
+	}
+	return rank
+}
+
+// issueIcon 异常指标状态对应的图标
+func issueIcon(issue AlertIssue) string {
+	if issue.Status == "critical" {
+		return "🔴"
+	}
+	return "🟡"
+}
+
+// issuesMarkdown 钉钉和企业微信消息中的异常指标列表，没有异常指标时返回空字符串
+func issuesMarkdown(issues []AlertIssue) string {
+	if len(issues) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("### 📌 异常指标\n")
+	for i, issue := range issues {
+		if i == maxAlertIssues {
+			fmt.Fprintf(&b, "> 其余 %d 项请查看报告\n", len(issues)-maxAlertIssues)
+			break
+		}
+		fmt.Fprintf(&b, "%s **%s/%s**：%d 条异常", issueIcon(issue), issue.Type, issue.Name, issue.Count)
+		if issue.Owner != "" {
+			fmt.Fprintf(&b, "，负责人 %s", issue.Owner)
+		}
+		if issue.RunbookURL != "" {
+			fmt.Fprintf(&b, "，[处理手册](%s)", issue.RunbookURL)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// issuesHTML 邮件中的异常指标列表，没有异常指标时返回空字符串
+func issuesHTML(issues []AlertIssue) string {
+	if len(issues) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`
+        <div style="background-color: #fff3cd; padding: 15px; border-radius: 5px; margin: 15px 0;">
+            <h3 style="color: #495057; margin-top: 0;">📌 异常指标</h3>
+            <ul style="margin: 0; padding-left: 20px;">`)
+	for i, issue := range issues {
+		if i == maxAlertIssues {
+			fmt.Fprintf(&b, `
+                <li>其余 %d 项请查看报告</li>`, len(issues)-maxAlertIssues)
+			break
+		}
+		fmt.Fprintf(&b, `
+                <li>%s <strong>%s/%s</strong>：%d 条异常`, issueIcon(issue), html.EscapeString(issue.Type), html.EscapeString(issue.Name), issue.Count)
+		if issue.Owner != "" {
+			fmt.Fprintf(&b, "，负责人 %s", html.EscapeString(issue.Owner))
+		}
+		if issue.RunbookURL != "" {
+			fmt.Fprintf(&b, `，<a href="%s" style="color: #007bff;">处理手册</a>`, html.EscapeString(issue.RunbookURL))
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString(`
+            </ul>
+        </div>
+`)
+	return b.String()
+}
+
 // CalculateTypeAlertSummary 按照metric_types.type分类计算告警汇总
 func CalculateTypeAlertSummary(data report.ReportData) []TypeAlertSummary {
 	typeSummaries := make(map[string]*TypeAlertSummary)
@@ -151,17 +285,18 @@ func SendDingtalk(config DingtalkConfig, reportPath string, projectName string,
 
 // SendDingtalkWithContext 发送钉钉通知（支持动态URL）
 func SendDingtalkWithContext(ctx context.Context, config DingtalkConfig, reportPath string, projectName string, Datasource string, alertSummary AlertSummary) error {
+	channel := "dingtalk"
 	if !config.Enabled {
-		log.Printf("钉钉通知未启用")
+		slog.Debug("通知渠道未启用", logging.KeyChannel, channel)
 		return nil
 	}
-	log.Printf("开始发送钉钉通知...")
+	slog.Info("开始发送通知", logging.KeyChannel, channel)
 	// 计算时间戳和签名
 	timestamp := time.Now().UnixMilli()
 	sign := calculateDingtalkSign(timestamp, config.Secret)
 	webhook := fmt.Sprintf("%s&timestamp=%d&sign=%s", config.Webhook, timestamp, sign)
 
-	log.Printf("准备发送请求到 webhook: %s", webhook)
+	slog.Debug("准备发送请求到 webhook", logging.KeyChannel, channel, "webhook", webhook)
 	// 创建multipart表单
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -169,20 +304,20 @@ func SendDingtalkWithContext(ctx context.Context, config DingtalkConfig, reportP
 	// 添加文件
 	file, err := os.Open(reportPath)
 	if err != nil {
-		log.Printf("打开文件失败: %v", err)
+		slog.Error("打开报告文件失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("打开文件失败: %v", err)
 	}
 	defer file.Close()
 
 	part, err := writer.CreateFormFile("file", filepath.Base(reportPath))
 	if err != nil {
-		log.Printf("创建表单文件失败: %v", err)
+		slog.Error("创建表单文件失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("创建表单文件失败: %v", err)
 	}
 
 	fileContent, err := os.ReadFile(reportPath)
 	if err != nil {
-		log.Printf("读取文件失败: %v", err)
+		slog.Error("读取报告文件失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("读取文件失败: %v", err)
 	}
 	part.Write(fileContent)
@@ -190,26 +325,10 @@ func SendDingtalkWithContext(ctx context.Context, config DingtalkConfig, reportP
 	// 生成报告的访问链接
 	reportFileName := filepath.Base(reportPath)
 
-	// 尝试从context中获取HTTP请求对象，用于动态URL生成
-	var reportLink string
-	if r, ok := ctx.Value("http_request").(*http.Request); ok {
-		// 打印调试信息
-		log.Printf("调试信息: r.Host = %s", r.Host)
-		log.Printf("调试信息: X-Forwarded-Host = %s", r.Header.Get("X-Forwarded-Host"))
-		log.Printf("调试信息: X-Forwarded-Proto = %s", r.Header.Get("X-Forwarded-Proto"))
-		log.Printf("调试信息: TLS = %v", r.TLS != nil)
-
-		// 使用动态URL生成
-		reportLink = utils.GetReportURL(r, reportFileName)
-		log.Printf("使用动态URL生成报告链接: %s", reportLink)
-		log.Printf("最终生成的 reportLink = %s", reportLink)
-	} else {
-		// 回退到配置的静态URL
-		reportLink = fmt.Sprintf("%s/api/promai/reports/%s", config.ReportURL, reportFileName)
-		log.Printf("使用配置的静态URL生成报告链接: %s", reportLink)
-		log.Printf("最终生成的 reportLink = %s", reportLink)
-	}
-	fmt.Printf("报告链接: %s", reportLink)
+	// 优先使用 external_url，其次根据触发巡检的HTTP请求推断
+	r, _ := ctx.Value("http_request").(*http.Request)
+	reportLink := utils.ReportLink(r, config.ReportURL, reportFileName)
+	slog.Debug("生成报告链接", logging.KeyChannel, channel, "report_link", reportLink)
 
 	// 添加消息内容
 	alertStatus := "✅ 正常"
@@ -231,6 +350,7 @@ func SendDingtalkWithContext(ctx context.Context, config DingtalkConfig, reportP
 				"  🔴 严重告警：%d\n"+
 				"  🟡 警告告警：%d\n"+
 				"**正常指标**：%d\n\n"+
+				"%s"+
 				"### 📄 报告详情\n"+
 				"**文件名**：`%s`\n"+
 				"**访问链接**：[点击查看报告](%s)\n\n"+
@@ -245,6 +365,7 @@ func SendDingtalkWithContext(ctx context.Context, config DingtalkConfig, reportP
 				alertSummary.CriticalAlerts,
 				alertSummary.WarningAlerts,
 				alertSummary.NormalMetrics,
+				issuesMarkdown(alertSummary.Issues),
 				reportFileName,
 				reportLink),
 		},
@@ -252,14 +373,14 @@ func SendDingtalkWithContext(ctx context.Context, config DingtalkConfig, reportP
 
 	jsonData, err := json.Marshal(messageContent)
 	if err != nil {
-		log.Printf("JSON编码失败: %v", err)
+		slog.Error("JSON编码失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("JSON编码失败: %v", err)
 	}
 
 	// 发送请求
 	req, err := http.NewRequest("POST", webhook, bytes.NewBuffer(jsonData))
 	if err != nil {
-		log.Printf("创建请求失败: %v", err)
+		slog.Error("创建请求失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("创建请求失败: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
@@ -267,18 +388,18 @@ func SendDingtalkWithContext(ctx context.Context, config DingtalkConfig, reportP
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("发送请求失败: %v", err)
+		slog.Error("发送请求失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("发送请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("钉钉响应状态码: %d, 响应内容: %s", resp.StatusCode, string(respBody))
+	slog.Debug("通知接口响应", logging.KeyChannel, channel, "status_code", resp.StatusCode, "body", string(respBody))
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("钉钉发送失败，状态码: %d", resp.StatusCode)
 	}
 
-	log.Printf("钉钉通知发送成功")
+	slog.Info("通知发送成功", logging.KeyChannel, channel)
 	return nil
 }
 
@@ -289,15 +410,13 @@ func SendEmail(config EmailConfig, reportPath string, projectName string, Dataso
 
 // SendEmailWithContext 发送邮件通知（支持动态URL）
 func SendEmailWithContext(ctx context.Context, config EmailConfig, reportPath string, projectName string, Datasource string, alertSummary AlertSummary) error {
+	channel := "email"
 	if !config.Enabled {
-		log.Printf("邮件通知未启用")
+		slog.Debug("通知渠道未启用", logging.KeyChannel, channel)
 		return nil
 	}
 
-	log.Printf("开始发送邮件通知...")
-	log.Printf("SMTP服务器: %s:%d", config.SMTPHost, config.SMTPPort)
-	log.Printf("发件人: %s", config.From)
-	log.Printf("收件人: %v", config.To)
+	slog.Info("开始发送通知", logging.KeyChannel, channel, "smtp_host", config.SMTPHost, "smtp_port", config.SMTPPort, "from", config.From, "to", strings.Join(config.To, ","))
 
 	e := email.NewEmail()
 	e.From = config.From
@@ -307,25 +426,10 @@ func SendEmailWithContext(ctx context.Context, config EmailConfig, reportPath st
 	// 生成报告的访问链接
 	reportFileName := filepath.Base(reportPath)
 
-	// 尝试从context中获取HTTP请求对象，用于动态URL生成
-	var reportLink string
-	if r, ok := ctx.Value("http_request").(*http.Request); ok {
-		// 打印调试信息
-		log.Printf("调试信息: r.Host = %s", r.Host)
-		log.Printf("调试信息: X-Forwarded-Host = %s", r.Header.Get("X-Forwarded-Host"))
-		log.Printf("调试信息: X-Forwarded-Proto = %s", r.Header.Get("X-Forwarded-Proto"))
-		log.Printf("调试信息: TLS = %v", r.TLS != nil)
-
-		// 使用动态URL生成
-		reportLink = utils.GetReportURL(r, reportFileName)
-		log.Printf("使用动态URL生成报告链接: %s", reportLink)
-		log.Printf("最终生成的 reportLink = %s", reportLink)
-	} else {
-		// 回退到配置的静态URL
-		reportLink = fmt.Sprintf("%s/api/promai/reports/%s", config.ReportURL, reportFileName)
-		log.Printf("使用配置的静态URL生成报告链接: %s", reportLink)
-		log.Printf("最终生成的 reportLink = %s", reportLink)
-	}
+	// 优先使用 external_url，其次根据触发巡检的HTTP请求推断
+	r, _ := ctx.Value("http_request").(*http.Request)
+	reportLink := utils.ReportLink(r, config.ReportURL, reportFileName)
+	slog.Debug("生成报告链接", logging.KeyChannel, channel, "report_link", reportLink)
 
 	// 添加更丰富的邮件内容
 	alertStatus := "✅ 正常"
@@ -370,7 +474,7 @@ func SendEmailWithContext(ctx context.Context, config EmailConfig, reportPath st
                 </tr>
             </table>
         </div>
-        
+        %s
         <div style="background-color: #e9ecef; padding: 15px; border-radius: 5px;">
             <h3 style="color: #495057; margin-top: 0;">📄 报告详情</h3>
             <p><strong>生成时间：</strong>%s</p>
@@ -390,13 +494,14 @@ func SendEmailWithContext(ctx context.Context, config EmailConfig, reportPath st
 		alertSummary.CriticalAlerts,
 		alertSummary.WarningAlerts,
 		alertSummary.NormalMetrics,
+		issuesHTML(alertSummary.Issues),
 		time.Now().Format("2006-01-02 15:04:05"),
 		reportFileName,
 		reportLink))
 
 	// 添加附件
 	if _, err := e.AttachFile(reportPath); err != nil {
-		log.Printf("添加附件失败: %v", err)
+		slog.Error("添加附件失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("添加附件失败: %v", err)
 	}
 
@@ -409,17 +514,13 @@ func SendEmailWithContext(ctx context.Context, config EmailConfig, reportPath st
 		ServerName:         config.SMTPHost,
 	}
 
-	log.Printf("正在发送邮件...")
+	slog.Debug("正在发送邮件", logging.KeyChannel, channel)
 	if err := e.SendWithTLS(addr, auth, tlsConfig); err != nil {
-		log.Printf("发送邮件失败: %v", err)
-		log.Printf("SMTP配置信息:")
-		log.Printf("- 服务器: %s", config.SMTPHost)
-		log.Printf("- 端口: %d", config.SMTPPort)
-		log.Printf("- 用户名: %s", config.Username)
+		slog.Error("发送邮件失败", logging.KeyChannel, channel, "smtp_host", config.SMTPHost, "smtp_port", config.SMTPPort, "username", config.Username, logging.Err(err))
 		return fmt.Errorf("发送邮件失败: %v", err)
 	}
 
-	log.Printf("邮件发送成功")
+	slog.Info("通知发送成功", logging.KeyChannel, channel)
 	return nil
 }
 
@@ -438,46 +539,33 @@ func SendWeChatWork(config WeChatWorkConfig, reportPath string, projectName stri
 
 // SendWeChatWorkWithWebhook 发送企业微信通知（支持动态机器人key）
 func SendWeChatWorkWithWebhook(ctx context.Context, botKey string, proxyURL string, reportPath string, projectName string, Datasource string, alertSummary AlertSummary) error {
+	channel := "wechat_bot"
 	if botKey == "" {
-		log.Printf("企业微信机器人key为空")
+		slog.Warn("企业微信机器人key为空", logging.KeyChannel, channel)
 		return nil
 	}
 
 	// 构建完整的webhook URL
 	webhookURL := fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=%s", botKey)
-	log.Printf("开始发送企业微信通知，使用机器人key: %s", botKey)
+	slog.Info("开始发送通知", logging.KeyChannel, channel, "bot_key", redact.Secret(botKey))
 
 	// 尝试从context中获取报告数据，用于分类汇总
 	var typeSummaries []TypeAlertSummary
 	if data, ok := ctx.Value("report_data").(report.ReportData); ok {
 		typeSummaries = CalculateTypeAlertSummary(data)
-		log.Printf("从报告数据中计算出分类汇总")
+		slog.Debug("从报告数据中计算出分类汇总", logging.KeyChannel, channel)
 	} else {
-		log.Printf("未找到报告数据，使用空分类汇总")
+		slog.Debug("未找到报告数据，使用空分类汇总", logging.KeyChannel, channel)
 		typeSummaries = []TypeAlertSummary{}
 	}
 
 	// 生成报告的访问链接
 	reportFileName := filepath.Base(reportPath)
 
-	// 尝试从context中获取HTTP请求对象，用于动态URL生成
-	var reportLink string
-	if r, ok := ctx.Value("http_request").(*http.Request); ok {
-		// 打印调试信息
-		log.Printf("调试信息: r.Host = %s", r.Host)
-		log.Printf("调试信息: X-Forwarded-Host = %s", r.Header.Get("X-Forwarded-Host"))
-		log.Printf("调试信息: X-Forwarded-Proto = %s", r.Header.Get("X-Forwarded-Proto"))
-		log.Printf("调试信息: TLS = %v", r.TLS != nil)
-
-		// 使用动态URL生成
-		reportLink = utils.GetReportURL(r, reportFileName)
-		log.Printf("使用动态URL生成报告链接: %s", reportLink)
-		log.Printf("最终生成的 reportLink = %s", reportLink)
-	} else {
-		// 回退到配置的静态URL（如果传入的webhookURL中包含配置信息）
-		reportLink = fmt.Sprintf("%s/api/promai/reports/%s", "https://alert.intra.kubehan.cn", reportFileName)
-		log.Printf("使用默认静态URL生成报告链接: %s", reportLink)
-	}
+	// 优先使用 external_url，其次根据触发巡检的HTTP请求推断
+	r, _ := ctx.Value("http_request").(*http.Request)
+	reportLink := utils.ReportLink(r, "", reportFileName)
+	slog.Debug("生成报告链接", logging.KeyChannel, channel, "report_link", reportLink)
 
 	// 构建消息内容
 	alertStatus := "✅ 正常"
@@ -511,6 +599,7 @@ func SendWeChatWorkWithWebhook(ctx context.Context, botKey string, proxyURL stri
 				"**总指标数**：%d个\n"+
 				"**异常指标**：%d个（严重%d个，警告%d个）\n"+
 				"**正常指标**：%d个\n\n"+
+				"%s"+
 				"📋[点击查看完整报告](%s)\n\n"+
 				"⏰ 生成时间：%s",
 				Datasource,
@@ -522,6 +611,7 @@ func SendWeChatWorkWithWebhook(ctx context.Context, botKey string, proxyURL stri
 				alertSummary.CriticalAlerts,
 				alertSummary.WarningAlerts,
 				alertSummary.NormalMetrics,
+				issuesMarkdown(alertSummary.Issues),
 				reportLink,
 				time.Now().Format("2006-01-02 15:04:05")),
 		},
@@ -529,7 +619,7 @@ func SendWeChatWorkWithWebhook(ctx context.Context, botKey string, proxyURL stri
 
 	jsonData, err := json.Marshal(messageContent)
 	if err != nil {
-		log.Printf("JSON编码失败: %v", err)
+		slog.Error("JSON编码失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("JSON编码失败: %v", err)
 	}
 
@@ -538,10 +628,10 @@ func SendWeChatWorkWithWebhook(ctx context.Context, botKey string, proxyURL stri
 
 	// 如果配置了代理，设置代理
 	if proxyURL != "" {
-		log.Printf("使用代理服务器: %s", proxyURL)
+		slog.Debug("使用代理服务器", logging.KeyChannel, channel, "proxy", proxyURL)
 		proxyURLParsed, err := url.Parse(proxyURL)
 		if err != nil {
-			log.Printf("解析代理URL失败: %v", err)
+			slog.Error("解析代理URL失败", logging.KeyChannel, channel, logging.Err(err))
 			return fmt.Errorf("解析代理URL失败: %v", err)
 		}
 
@@ -554,70 +644,56 @@ func SendWeChatWorkWithWebhook(ctx context.Context, botKey string, proxyURL stri
 	// 发送请求
 	req, err := http.NewRequest("POST", webhookURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		log.Printf("创建请求失败: %v", err)
+		slog.Error("创建请求失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("创建请求失败: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	log.Printf("准备发送请求到 webhook: %s", webhookURL)
+	slog.Debug("准备发送请求到 webhook", logging.KeyChannel, channel, "webhook", webhookURL)
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("发送请求失败: %v", err)
+		slog.Error("发送请求失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("发送请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("企业微信响应状态码: %d, 响应内容: %s", resp.StatusCode, string(respBody))
+	slog.Debug("通知接口响应", logging.KeyChannel, channel, "status_code", resp.StatusCode, "body", string(respBody))
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("企业微信发送失败，状态码: %d", resp.StatusCode)
 	}
 
-	log.Printf("企业微信通知发送成功")
+	slog.Info("通知发送成功", logging.KeyChannel, channel)
 	return nil
 }
 
 // SendWeChatWorkWithContext 发送企业微信通知（支持动态URL）
 func SendWeChatWorkWithContext(ctx context.Context, config WeChatWorkConfig, reportPath string, projectName string, Datasource string, alertSummary AlertSummary) error {
+	channel := "wechat_work"
 	if !config.Enabled {
-		log.Printf("企业微信通知未启用")
+		slog.Debug("通知渠道未启用", logging.KeyChannel, channel)
 		return nil
 	}
-	log.Printf("开始发送企业微信通知...")
+	slog.Info("开始发送通知", logging.KeyChannel, channel)
 
 	// 尝试从context中获取报告数据，用于分类汇总
 	var typeSummaries []TypeAlertSummary
 	if data, ok := ctx.Value("report_data").(report.ReportData); ok {
 		typeSummaries = CalculateTypeAlertSummary(data)
-		log.Printf("从报告数据中计算出分类汇总")
+		slog.Debug("从报告数据中计算出分类汇总", logging.KeyChannel, channel)
 	} else {
-		log.Printf("未找到报告数据，使用空分类汇总")
+		slog.Debug("未找到报告数据，使用空分类汇总", logging.KeyChannel, channel)
 		typeSummaries = []TypeAlertSummary{}
 	}
 
 	// 生成报告的访问链接
 	reportFileName := filepath.Base(reportPath)
 
-	// 尝试从context中获取HTTP请求对象，用于动态URL生成
-	var reportLink string
-	if r, ok := ctx.Value("http_request").(*http.Request); ok {
-		// 打印调试信息
-		log.Printf("调试信息: r.Host = %s", r.Host)
-		log.Printf("调试信息: X-Forwarded-Host = %s", r.Header.Get("X-Forwarded-Host"))
-		log.Printf("调试信息: X-Forwarded-Proto = %s", r.Header.Get("X-Forwarded-Proto"))
-		log.Printf("调试信息: TLS = %v", r.TLS != nil)
-
-		// 使用动态URL生成
-		reportLink = utils.GetReportURL(r, reportFileName)
-		log.Printf("使用动态URL生成报告链接: %s", reportLink)
-		log.Printf("最终生成的 reportLink = %s", reportLink)
-	} else {
-		// 回退到配置的静态URL
-		reportLink = fmt.Sprintf("%s/api/promai/reports/%s", config.ReportURL, reportFileName)
-		log.Printf("使用配置的静态URL生成报告链接: %s", reportLink)
-		log.Printf("最终生成的 reportLink = %s", reportLink)
-	}
+	// 优先使用 external_url，其次根据触发巡检的HTTP请求推断
+	r, _ := ctx.Value("http_request").(*http.Request)
+	reportLink := utils.ReportLink(r, config.ReportURL, reportFileName)
+	slog.Debug("生成报告链接", logging.KeyChannel, channel, "report_link", reportLink)
 
 	// 构建消息内容
 	alertStatus := "✅ 正常"
@@ -651,6 +727,7 @@ func SendWeChatWorkWithContext(ctx context.Context, config WeChatWorkConfig, rep
 				"**总指标数**：%d个\n"+
 				"**异常指标**：%d个（严重%d个，警告%d个）\n"+
 				"**正常指标**：%d个\n\n"+
+				"%s"+
 				"📋[点击查看完整报告](%s)\n\n"+
 				"⏰ 生成时间：%s",
 				Datasource,
@@ -662,6 +739,7 @@ func SendWeChatWorkWithContext(ctx context.Context, config WeChatWorkConfig, rep
 				alertSummary.CriticalAlerts,
 				alertSummary.WarningAlerts,
 				alertSummary.NormalMetrics,
+				issuesMarkdown(alertSummary.Issues),
 				reportLink,
 				time.Now().Format("2006-01-02 15:04:05")),
 		},
@@ -669,7 +747,7 @@ func SendWeChatWorkWithContext(ctx context.Context, config WeChatWorkConfig, rep
 
 	jsonData, err := json.Marshal(messageContent)
 	if err != nil {
-		log.Printf("JSON编码失败: %v", err)
+		slog.Error("JSON编码失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("JSON编码失败: %v", err)
 	}
 
@@ -678,10 +756,10 @@ func SendWeChatWorkWithContext(ctx context.Context, config WeChatWorkConfig, rep
 
 	// 如果配置了代理，设置代理
 	if config.ProxyURL != "" {
-		log.Printf("使用代理服务器: %s", config.ProxyURL)
+		slog.Debug("使用代理服务器", logging.KeyChannel, channel, "proxy", config.ProxyURL)
 		proxyURL, err := url.Parse(config.ProxyURL)
 		if err != nil {
-			log.Printf("解析代理URL失败: %v", err)
+			slog.Error("解析代理URL失败", logging.KeyChannel, channel, logging.Err(err))
 			return fmt.Errorf("解析代理URL失败: %v", err)
 		}
 
@@ -694,26 +772,26 @@ func SendWeChatWorkWithContext(ctx context.Context, config WeChatWorkConfig, rep
 	// 发送请求
 	req, err := http.NewRequest("POST", config.Webhook, bytes.NewBuffer(jsonData))
 	if err != nil {
-		log.Printf("创建请求失败: %v", err)
+		slog.Error("创建请求失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("创建请求失败: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	log.Printf("准备发送请求到 webhook: %s", config.Webhook)
+	slog.Debug("准备发送请求到 webhook", logging.KeyChannel, channel, "webhook", config.Webhook)
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("发送请求失败: %v", err)
+		slog.Error("发送请求失败", logging.KeyChannel, channel, logging.Err(err))
 		return fmt.Errorf("发送请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("企业微信响应状态码: %d, 响应内容: %s", resp.StatusCode, string(respBody))
+	slog.Debug("通知接口响应", logging.KeyChannel, channel, "status_code", resp.StatusCode, "body", string(respBody))
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("企业微信发送失败，状态码: %d", resp.StatusCode)
 	}
 
-	log.Printf("企业微信通知发送成功")
+	slog.Info("通知发送成功", logging.KeyChannel, channel)
 	return nil
 }
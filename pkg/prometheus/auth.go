@@ -0,0 +1,41 @@
+package prometheus
+
+import (
+	"net/http"
+)
+
+// Auth 连接 Prometheus 的认证配置，basic_auth 与 bearer_token 二选一
+// password_file、bearer_token_file 在加载配置时读取，文件内容更新后需要重新加载配置
+type Auth struct {
+	BasicAuth       BasicAuth `yaml:"basic_auth"`
+	BearerToken     string    `yaml:"bearer_token"`
+	BearerTokenFile string    `yaml:"bearer_token_file"`
+}
+
+// BasicAuth HTTP Basic 认证
+type BasicAuth struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+// Enabled 是否配置了认证
+func (a Auth) Enabled() bool {
+	return a.BasicAuth.Username != "" || a.BearerToken != ""
+}
+
+// authRoundTripper 为每个请求添加认证头
+type authRoundTripper struct {
+	auth Auth
+	next http.RoundTripper
+}
+
+func (rt authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if rt.auth.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+rt.auth.BearerToken)
+	} else {
+		req.SetBasicAuth(rt.auth.BasicAuth.Username, rt.auth.BasicAuth.Password)
+	}
+	return rt.next.RoundTrip(req)
+}
@@ -14,9 +14,18 @@ type Client struct {
 
 // NewClient 创建新的 Prometheus 客户端
 func NewClient(url string) (*Client, error) {
-	client, err := api.NewClient(api.Config{
+	return NewClientWithAuth(url, Auth{})
+}
+
+// NewClientWithAuth 创建使用指定认证方式的 Prometheus 客户端
+func NewClientWithAuth(url string, auth Auth) (*Client, error) {
+	cfg := api.Config{
 		Address: url,
-	})
+	}
+	if auth.Enabled() {
+		cfg.RoundTripper = authRoundTripper{auth: auth, next: api.DefaultRoundTripper}
+	}
+	client, err := api.NewClient(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating prometheus client: %w", err)
 	}
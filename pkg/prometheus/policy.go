@@ -0,0 +1,219 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// 自定义数据源URL策略模式
+const (
+	CustomURLsAllow     = "allow"     // 允许任意URL
+	CustomURLsDeny      = "deny"      // 禁止自定义URL，只能使用配置的数据源名称（默认）
+	CustomURLsAllowlist = "allowlist" // 仅允许 allowed_hosts / allowed_cidrs 中的地址
+)
+
+// ErrURLBlocked 自定义数据源URL被策略拦截
+var ErrURLBlocked = errors.New("datasource URL blocked by policy")
+
+// URLPolicyConfig 请求参数中自定义数据源URL（datasource=http(s)://...）的访问策略
+type URLPolicyConfig struct {
+	CustomURLs   string   `yaml:"custom_urls"`   // allow、deny、allowlist
+	AllowedHosts []string `yaml:"allowed_hosts"` // 主机名，支持 *.example.com 通配子域名
+	AllowedCIDRs []string `yaml:"allowed_cidrs"` // 目标IP所在网段，支持单个IP
+}
+
+// URLPolicy 自定义数据源URL策略
+type URLPolicy struct {
+	mode  string
+	hosts []string
+	nets  []*net.IPNet
+}
+
+// NewURLPolicy 根据配置创建URL策略
+func NewURLPolicy(cfg URLPolicyConfig) (*URLPolicy, error) {
+	p := &URLPolicy{mode: cfg.CustomURLs}
+	if p.mode == "" {
+		p.mode = CustomURLsDeny
+	}
+	switch p.mode {
+	case CustomURLsAllow, CustomURLsDeny:
+	case CustomURLsAllowlist:
+		if len(cfg.AllowedHosts) == 0 && len(cfg.AllowedCIDRs) == 0 {
+			return nil, fmt.Errorf("datasource_policy: allowlist mode requires allowed_hosts or allowed_cidrs")
+		}
+	default:
+		return nil, fmt.Errorf("datasource_policy.custom_urls: unknown mode %q (expected allow, deny or allowlist)", cfg.CustomURLs)
+	}
+
+	for _, host := range cfg.AllowedHosts {
+		p.hosts = append(p.hosts, strings.ToLower(strings.TrimSpace(host)))
+	}
+	for _, entry := range cfg.AllowedCIDRs {
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("datasource_policy.allowed_cidrs: %w", err)
+		}
+		p.nets = append(p.nets, network)
+	}
+	return p, nil
+}
+
+// Mode 返回策略模式
+func (p *URLPolicy) Mode() string {
+	return p.mode
+}
+
+// Check 检查自定义数据源URL是否允许访问，拦截时返回包装了 ErrURLBlocked 的错误
+// 主机名不在 allowed_hosts 中时按解析出的全部IP匹配 allowed_cidrs，建立连接时还会再次校验实际连接的IP
+func (p *URLPolicy) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: invalid datasource URL", ErrURLBlocked)
+	}
+
+	switch p.mode {
+	case CustomURLsAllow:
+		return nil
+	case CustomURLsDeny:
+		return fmt.Errorf("%w: custom datasource URLs are disabled, use a configured datasource name", ErrURLBlocked)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if p.hostAllowed(host) {
+		return nil
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.LookupIP(host)
+		if err != nil || len(addrs) == 0 {
+			return fmt.Errorf("%w: host %q is not in allowed_hosts and cannot be resolved", ErrURLBlocked, host)
+		}
+		ips = addrs
+	}
+	for _, ip := range ips {
+		if !p.ipAllowed(ip) {
+			return fmt.Errorf("%w: host %q (%s) is not in allowed_hosts or allowed_cidrs", ErrURLBlocked, host, ip)
+		}
+	}
+	return nil
+}
+
+// maxRedirects 访问自定义数据源时最多跟随的重定向次数，与 net/http 默认值一致
+const maxRedirects = 10
+
+// NewClient 检查URL策略后创建 Prometheus 客户端
+// allowlist 模式下每次重定向都重新检查策略；连接未被 allowed_hosts 放行的主机时校验实际连接的IP，防止DNS重绑定绕过检查
+func (p *URLPolicy) NewClient(rawURL string) (*Client, error) {
+	if err := p.Check(rawURL); err != nil {
+		return nil, err
+	}
+
+	cfg := api.Config{Address: rawURL}
+	if p.mode == CustomURLsAllowlist {
+		cfg.Client = &http.Client{
+			Transport: p.transport(),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				return p.Check(req.URL.String())
+			},
+		}
+	}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating prometheus client: %w", err)
+	}
+	return &Client{API: v1.NewAPI(client)}, nil
+}
+
+// transport 创建 allowlist 模式使用的连接，主机名被 allowed_hosts 放行时直接连接，否则只允许连接 allowed_cidrs 中的IP
+func (p *URLPolicy) transport() *http.Transport {
+	transport := api.DefaultRoundTripper.(*http.Transport).Clone()
+	direct := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	checked := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !p.ipAllowed(ip) {
+				return fmt.Errorf("%w: connection to %s is not in allowed_cidrs", ErrURLBlocked, host)
+			}
+			return nil
+		},
+	}
+	// 经HTTP代理连接时无法校验真实目标IP，因此不使用环境变量中的代理
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if p.hostAllowed(strings.ToLower(host)) {
+			return direct.DialContext(ctx, network, address)
+		}
+		return checked.DialContext(ctx, network, address)
+	}
+	return transport
+}
+
+// hostAllowed 判断主机名是否在 allowed_hosts 中
+func (p *URLPolicy) hostAllowed(host string) bool {
+	for _, allowed := range p.hosts {
+		if allowed == host {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed 判断IP是否在 allowed_cidrs 中
+func (p *URLPolicy) ipAllowed(ip net.IP) bool {
+	for _, network := range p.nets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetwork 解析CIDR，单个IP按 /32 或 /128 处理
+func parseNetwork(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+	}
+	return network, nil
+}
@@ -0,0 +1,116 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewURLPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  URLPolicyConfig
+		mode string
+		err  string
+	}{
+		{name: "默认禁止", cfg: URLPolicyConfig{}, mode: CustomURLsDeny},
+		{name: "allow", cfg: URLPolicyConfig{CustomURLs: "allow"}, mode: CustomURLsAllow},
+		{name: "allowlist", cfg: URLPolicyConfig{CustomURLs: "allowlist", AllowedCIDRs: []string{"10.0.0.0/8", "192.168.1.5"}}, mode: CustomURLsAllowlist},
+		{name: "allowlist 缺少地址", cfg: URLPolicyConfig{CustomURLs: "allowlist"}, err: "requires allowed_hosts or allowed_cidrs"},
+		{name: "未知模式", cfg: URLPolicyConfig{CustomURLs: "open"}, err: `unknown mode "open"`},
+		{name: "非法网段", cfg: URLPolicyConfig{CustomURLs: "allowlist", AllowedCIDRs: []string{"10.0.0.0/33"}}, err: "invalid IP or CIDR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewURLPolicy(tt.cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("NewURLPolicy() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewURLPolicy() error = %v", err)
+			}
+			if p.Mode() != tt.mode {
+				t.Fatalf("Mode() = %q, want %q", p.Mode(), tt.mode)
+			}
+		})
+	}
+}
+
+func TestURLPolicyCheck(t *testing.T) {
+	allowlist := URLPolicyConfig{
+		CustomURLs:   CustomURLsAllowlist,
+		AllowedHosts: []string{"prometheus.example.com", "*.monitoring.example.com"},
+		AllowedCIDRs: []string{"10.20.0.0/16", "192.168.1.5", "fd00::/8"},
+	}
+	tests := []struct {
+		name    string
+		cfg     URLPolicyConfig
+		url     string
+		allowed bool
+	}{
+		{name: "allow 任意地址", cfg: URLPolicyConfig{CustomURLs: CustomURLsAllow}, url: "http://169.254.169.254/latest", allowed: true},
+		{name: "allow 非HTTP协议", cfg: URLPolicyConfig{CustomURLs: CustomURLsAllow}, url: "file:///etc/passwd"},
+		{name: "allow 缺少主机", cfg: URLPolicyConfig{CustomURLs: CustomURLsAllow}, url: "http:///api"},
+		{name: "deny", cfg: URLPolicyConfig{CustomURLs: CustomURLsDeny}, url: "http://prometheus.example.com"},
+		{name: "主机名", cfg: allowlist, url: "https://prometheus.example.com:9090", allowed: true},
+		{name: "主机名大小写", cfg: allowlist, url: "http://Prometheus.Example.COM", allowed: true},
+		{name: "通配子域名", cfg: allowlist, url: "http://prom.monitoring.example.com", allowed: true},
+		{name: "通配不匹配父域名", cfg: allowlist, url: "http://monitoring.example.com.evil.test"},
+		{name: "网段内IP", cfg: allowlist, url: "http://10.20.3.4:9090", allowed: true},
+		{name: "单个IP", cfg: allowlist, url: "http://192.168.1.5:9090", allowed: true},
+		{name: "IPv6网段", cfg: allowlist, url: "http://[fd00::1]:9090", allowed: true},
+		{name: "网段外IP", cfg: allowlist, url: "http://10.21.0.1:9090"},
+		{name: "元数据地址", cfg: allowlist, url: "http://169.254.169.254/latest/meta-data"},
+		{name: "回环地址", cfg: allowlist, url: "http://127.0.0.1:8091"},
+		{name: "无法解析的主机", cfg: allowlist, url: "http://no-such-host.invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewURLPolicy(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewURLPolicy() error = %v", err)
+			}
+			err = p.Check(tt.url)
+			if tt.allowed && err != nil {
+				t.Fatalf("Check(%q) = %v, want allowed", tt.url, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrURLBlocked) {
+				t.Fatalf("Check(%q) = %v, want ErrURLBlocked", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestURLPolicyRedirect(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer internal.Close()
+	// allowed_hosts 放行的主机重定向到未放行的地址
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer public.Close()
+
+	p, err := NewURLPolicy(URLPolicyConfig{CustomURLs: CustomURLsAllowlist, AllowedHosts: []string{"localhost"}})
+	if err != nil {
+		t.Fatalf("NewURLPolicy() error = %v", err)
+	}
+	client, err := p.NewClient(strings.Replace(public.URL, "127.0.0.1", "localhost", 1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, err := client.API.Query(ctx, "up", time.Now()); err == nil || !strings.Contains(err.Error(), "is not in allowed_hosts or allowed_cidrs") {
+		t.Fatalf("Query() error = %v, want redirect target rejected by policy", err)
+	}
+}
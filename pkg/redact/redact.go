@@ -0,0 +1,86 @@
+package redact
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask 替换敏感值的占位符
+const Mask = "xxxxx"
+
+// minSecretLength 注册的敏感值短于该长度时忽略，避免误替换普通文本
+const minSecretLength = 6
+
+var (
+	// urlUserinfo 匹配URL中的 user:password@
+	urlUserinfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^/@\s:]+):[^/@\s]+@`)
+	// sensitiveParam 匹配查询字符串中的敏感参数，如 access_token=...、key=...、sign=...
+	sensitiveParam = regexp.MustCompile(`(?i)((?:^|[?&;\s])(?:access_token|token|key|sign|secret|password|passwd|wechat_bot_key|bot_key|api_key|apikey)=)[^&\s"'<>]+`)
+	// sensitiveMapValue 匹配 url.Values 打印形式中的敏感参数，如 map[wechat_bot_key:[...]]
+	sensitiveMapValue = regexp.MustCompile(`(?i)\b((?:access_token|token|key|sign|secret|password|passwd|wechat_bot_key|bot_key|api_key|apikey):\[)[^\]]*\]`)
+	// bearerToken 匹配 Authorization 头中的令牌
+	bearerToken = regexp.MustCompile(`(?i)(\bBearer\s+)[A-Za-z0-9._~+/=-]+`)
+)
+
+var (
+	mu      sync.RWMutex
+	secrets = make(map[string]struct{})
+	ordered []string // 按长度降序，避免较短的敏感值先替换导致较长的敏感值残留
+)
+
+// Register 注册需要从输出中隐藏的敏感值（如配置中的密码、签名密钥、API令牌）
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	changed := false
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) < minSecretLength {
+			continue
+		}
+		if _, exists := secrets[v]; !exists {
+			secrets[v] = struct{}{}
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	ordered = ordered[:0]
+	for v := range secrets {
+		ordered = append(ordered, v)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return len(ordered[i]) > len(ordered[j]) })
+}
+
+// String 隐藏文本中的敏感信息：已注册的敏感值、URL中的密码、查询参数中的令牌/密钥/签名以及 Bearer 令牌
+func String(s string) string {
+	if s == "" {
+		return s
+	}
+
+	mu.RLock()
+	for _, v := range ordered {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, Mask)
+		}
+	}
+	mu.RUnlock()
+
+	s = urlUserinfo.ReplaceAllString(s, "$1:"+Mask+"@")
+	s = sensitiveParam.ReplaceAllString(s, "${1}"+Mask)
+	s = sensitiveMapValue.ReplaceAllString(s, "${1}"+Mask+"]")
+	s = bearerToken.ReplaceAllString(s, "${1}"+Mask)
+	return s
+}
+
+// Secret 返回敏感值的脱敏形式，仅保留前4个字符用于排查
+func Secret(s string) string {
+	if len(s) <= 8 {
+		return Mask
+	}
+	return s[:4] + Mask
+}
@@ -1,10 +1,12 @@
 package report
 
 import (
-    "log"
+    "log/slog"
     "os"
     "path/filepath"
     "time"
+
+    "PromAI/pkg/logging"
 )
 
 // CleanupReports 清理旧报告
@@ -26,10 +28,10 @@ func CleanupReports(maxAge int) error {
         // 检查文件年龄
         if info.ModTime().Add(time.Duration(maxAge) * 24 * time.Hour).Before(now) {
             if err := os.Remove(path); err != nil {
-                log.Printf("删除报告文件失败 %s: %v", path, err)
+                slog.Error("删除报告文件失败", "file", path, logging.Err(err))
                 return err
             }
-            log.Printf("已删除过期报告: %s", path)
+            slog.Info("已删除过期报告", "file", path)
         }
 
         return nil
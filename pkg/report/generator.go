@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"math"
 	"os"
+	"path/filepath"
 	"sort"
 	"time"
+
+	"PromAI/pkg/logging"
 )
 
 type LabelData struct {
@@ -36,6 +39,10 @@ type MetricData struct {
 	StatusText  string
 	Timestamp   time.Time
 	Labels      []LabelData // 改用结构化的标签数据
+	Owner       string      // 指标负责人
+	RunbookURL  string      // 处理手册地址
+	Severity    string      // 异常时的影响级别
+	Tags        []string
 }
 
 type MetricGroup struct {
@@ -49,6 +56,8 @@ type ReportData struct {
 	ChartData    map[string]template.JS
 	Project      string
 	Datasource   string
+	// DatasourceName 数据源在权限范围中的名称（配置的数据源名称、default 或自定义URL），写入报告用于按请求方数据源范围过滤
+	DatasourceName string
 }
 
 func GetStatusText(status string) string {
@@ -62,7 +71,14 @@ func GetStatusText(status string) string {
 	}
 }
 
+// GenerateReport 计算统计与图表数据并渲染HTML报告
 func GenerateReport(data ReportData) (string, error) {
+	PrepareReportData(&data)
+	return RenderReport(data)
+}
+
+// PrepareReportData 计算每个指标组的统计信息并生成图表数据
+func PrepareReportData(data *ReportData) {
 	// 计算每个组的统计信息
 	for _, group := range data.MetricGroups {
 		stats := GroupStats{
@@ -146,8 +162,6 @@ func GenerateReport(data ReportData) (string, error) {
 			for labelValue := range labelValuesByMetric[metricKey] {
 
 				metricValues[labelValue] = 0
-
-				log.Println("标签值：", labelValue, "指标值：", metricValues[labelValue])
 			}
 
 			// 填充实际的指标值
@@ -182,28 +196,42 @@ func GenerateReport(data ReportData) (string, error) {
 		valuesJSON, _ := json.Marshal(values)
 		data.ChartData[key] = template.JS(valuesJSON)
 	}
+}
 
+// RenderReport 使用报告模板渲染HTML文件，返回报告文件路径
+func RenderReport(data ReportData) (string, error) {
 	// 生成报告
 	tmpl, err := template.ParseFiles("templates/report.html")
 	if err != nil {
 		return "", fmt.Errorf("parsing template: %w", err)
 	}
 
-	// 创建输出文件
+	// 先写入临时文件再重命名，进程中途退出时不会在报告目录留下不完整的报告
 	filename := fmt.Sprintf("reports/inspection_report_%s.html", time.Now().Format("20060102_150405"))
-	file, err := os.Create(filename)
+	file, err := os.CreateTemp(filepath.Dir(filename), ".inspection_report_*.html.tmp")
 	if err != nil {
 		return "", fmt.Errorf("creating output file: %w", err)
 	}
-	defer file.Close()
+	tmpName := file.Name()
+	defer os.Remove(tmpName) // 重命名成功后为空操作
 
 	// 执行模板
 	if err := tmpl.Execute(file, data); err != nil {
+		file.Close()
 		return "", fmt.Errorf("executing template: %w", err)
 	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("writing output file: %w", err)
+	}
+	if err := os.Chmod(tmpName, 0o644); err != nil {
+		return "", fmt.Errorf("writing output file: %w", err)
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return "", fmt.Errorf("writing output file: %w", err)
+	}
 
 	// log.Println("Report generated successfully:", filename)
-	log.Printf("项目[%s]报告生成成功: %s", data.Project, filename)
+	slog.Info("报告生成成功", "project", data.Project, logging.KeyDatasource, data.Datasource, "file", filename)
 
 	return filename, nil // 添加返回语句
 }
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultBasePath 默认的路由前缀
+const DefaultBasePath = "/api/promai"
+
+// Config HTTP 服务配置
+type Config struct {
+	// ExternalURL 用户访问 PromAI 的地址（不含路由前缀），如 https://promai.example.com，报告链接和通知统一使用该地址
+	ExternalURL string `yaml:"external_url"`
+	// BasePath 页面和接口的路由前缀，默认 /api/promai
+	BasePath string    `yaml:"base_path"`
+	TLS      TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig HTTPS 证书配置，证书和私钥文件更新后自动重新加载
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Enabled 判断是否配置了证书
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// NormalizeBasePath 规范化路由前缀：为空时返回默认前缀，"/" 返回空字符串（挂载在根路径），去掉末尾的 "/"
+func NormalizeBasePath(path string) (string, error) {
+	if path == "" {
+		return DefaultBasePath, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("server.base_path: %q must start with /", path)
+	}
+	if strings.ContainsAny(path, "?#{} ") {
+		return "", fmt.Errorf("server.base_path: %q contains invalid characters", path)
+	}
+	return strings.TrimRight(path, "/"), nil
+}
+
+// NormalizeExternalURL 校验对外地址并去掉末尾的 "/"，为空时返回空字符串
+func NormalizeExternalURL(rawURL string) (string, error) {
+	if rawURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("server.external_url: %q must be an absolute http(s) URL", rawURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("server.external_url: %q must not contain a query or fragment", rawURL)
+	}
+	return strings.TrimRight(rawURL, "/"), nil
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"PromAI/pkg/logging"
+)
+
+// certCheckInterval 检查证书文件是否更新的最小间隔
+const certCheckInterval = 10 * time.Second
+
+// CertReloader 在握手时提供证书，证书或私钥文件修改后自动重新加载，无需重启服务
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+// NewCertReloader 加载证书和私钥，文件不存在或不匹配时返回错误
+func NewCertReloader(cfg TLSConfig) (*CertReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("server.tls: both cert_file and key_file are required")
+	}
+	r := &CertReloader{certFile: cfg.CertFile, keyFile: cfg.KeyFile}
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return nil, fmt.Errorf("server.tls: %w", err)
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		return nil, fmt.Errorf("server.tls: %w", err)
+	}
+	return r, nil
+}
+
+// TLSConfig 返回使用该证书的 TLS 配置
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// GetCertificate 返回当前证书，距上次检查超过 certCheckInterval 时检查文件是否更新
+// 重新加载失败时继续使用旧证书
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) >= certCheckInterval {
+		r.lastCheck = time.Now()
+		certMod, keyMod, err := r.modTimes()
+		if err != nil {
+			slog.Warn("检查TLS证书文件失败，继续使用当前证书", logging.Err(err))
+		} else if !certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod) {
+			if err := r.load(certMod, keyMod); err != nil {
+				slog.Warn("重新加载TLS证书失败，继续使用当前证书", logging.Err(err))
+			} else {
+				slog.Info("TLS证书已重新加载", "cert_file", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load 读取证书和私钥，调用方需持有锁或处于初始化阶段
+func (r *CertReloader) load(certMod, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	return nil
+}
+
+// modTimes 返回证书和私钥文件的修改时间
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
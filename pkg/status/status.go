@@ -2,10 +2,13 @@ package status
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"PromAI/pkg/config"
+	"PromAI/pkg/logging"
 	"PromAI/pkg/metrics"
 
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
@@ -78,7 +81,7 @@ func GenerateStatusData(days int) (*StatusData, error) {
 func CollectMetricStatus(client metrics.PrometheusAPI, config *config.Config, datasource string) (*StatusData, error) {
 	data, err := GenerateStatusData(7) // 显示最近7天的数据
 	if err != nil {
-		log.Printf("生成状态数据失败: %v", err)
+		slog.Error("生成状态数据失败", logging.Err(err))
 		return nil, err
 	}
 
@@ -89,11 +92,11 @@ func CollectMetricStatus(client metrics.PrometheusAPI, config *config.Config, da
 		data.Datasource = config.PrometheusURL
 	}
 
-	log.Printf("开始收集指标状态数据，时间范围: %v", data.Dates)
+	slog.Debug("开始收集指标状态数据", logging.KeyDatasource, data.Datasource, "dates", strings.Join(data.Dates, ","))
 
 	// 遍历所有指标类型
 	for _, metricType := range config.MetricTypes {
-		log.Printf("处理指标类型: %s", metricType.Type)
+		slog.Debug("处理指标类型", logging.KeyMetricType, metricType.Type)
 
 		// 统计每种类型的指标数量
 		data.Summary.TypeCounts[metricType.Type] = len(metricType.Metrics)
@@ -102,8 +105,7 @@ func CollectMetricStatus(client metrics.PrometheusAPI, config *config.Config, da
 
 		// 遍历每个指标
 		for _, metric := range metricType.Metrics {
-			log.Printf("处理指标: %s (阈值: %v %s, 阈值类型: %s)",
-				metric.Name, metric.Threshold, metric.Unit, metric.ThresholdType)
+			slog.Debug("处理指标", logging.KeyMetric, metric.Name, "threshold", metric.Threshold, "unit", metric.Unit, "threshold_type", metric.ThresholdType)
 
 			metricStatus := MetricStatus{
 				Name:          metric.Name,
@@ -117,20 +119,18 @@ func CollectMetricStatus(client metrics.PrometheusAPI, config *config.Config, da
 			for _, date := range data.Dates {
 				status, err := queryMetricStatus(client, metric, date)
 				if err != nil {
-					log.Printf("查询指标 [%s] 在 %s 的状态失败: %v", metric.Name, date, err)
+					slog.Warn("查询指标状态失败", logging.KeyMetric, metric.Name, "date", date, logging.KeyDatasource, data.Datasource, logging.Err(err))
 					metricStatus.DailyStatus[date] = "abnormal"
 					data.Summary.Abnormal++
 				} else {
 					metricStatus.DailyStatus[date] = status
+					slog.Debug("指标每日状态", logging.KeyMetric, metric.Name, "date", date, "status", status)
 					switch status {
 					case "normal":
-						log.Printf("指标 [%s] 在 %s 状态正常", metric.Name, date)
 						data.Summary.Normal++
 					case "warning":
-						log.Printf("指标 [%s] 在 %s 状态警告", metric.Name, date)
 						data.Summary.Warning++
 					case "abnormal":
-						log.Printf("指标 [%s] 在 %s 状态异常", metric.Name, date)
 						data.Summary.Abnormal++
 					}
 				}
@@ -140,12 +140,12 @@ func CollectMetricStatus(client metrics.PrometheusAPI, config *config.Config, da
 		}
 	}
 
-	log.Printf("状态数据收集完成. 总指标数: %d, 正常: %d, 警告: %d, 异常: %d",
-		data.Summary.TotalMetrics, data.Summary.Normal, data.Summary.Warning, data.Summary.Abnormal)
+	slog.Info("状态数据收集完成", logging.KeyDatasource, data.Datasource,
+		"total", data.Summary.TotalMetrics, "normal", data.Summary.Normal, "warning", data.Summary.Warning, "abnormal", data.Summary.Abnormal)
 
 	// 打印每种类型的指标数量
 	for typeName, count := range data.Summary.TypeCounts {
-		log.Printf("指标类型 [%s] 包含 %d 个指标", typeName, count)
+		slog.Debug("指标类型包含的指标数", logging.KeyMetricType, typeName, "count", count)
 	}
 
 	return data, nil
@@ -163,24 +163,8 @@ func queryMetricStatus(client metrics.PrometheusAPI, metric config.MetricConfig,
 	startTime := time.Date(time.Now().Year(), dateTime.Month(), dateTime.Day(), 0, 0, 0, 0, time.Local)
 	endTime := startTime.Add(24 * time.Hour).Add(-time.Second)
 
-	log.Printf(`
-查询指标: [%s]
-时间范围: %s 到 %s
-PromQL: %s
-调试步骤:
-1. 打开 Prometheus UI
-2. 粘贴查询: %s
-3. 设置时间范围为: %s 到 %s
-4. 使用客户端: %T
--------------------`,
-		metric.Name,
-		startTime.Format("2006-01-02 15:04:05"),
-		endTime.Format("2006-01-02 15:04:05"),
-		metric.Query,
-		metric.Query,
-		startTime.Format("2006-01-02 15:04:05"),
-		endTime.Format("2006-01-02 15:04:05"),
-		client)
+	slog.Debug("查询指标状态", logging.KeyMetric, metric.Name, "query", metric.Query,
+		"start", startTime.Format("2006-01-02 15:04:05"), "end", endTime.Format("2006-01-02 15:04:05"))
 
 	// 直接使用原始查询语句
 	result, _, err := client.QueryRange(ctx, metric.Query, v1.Range{
@@ -190,18 +174,18 @@ PromQL: %s
 	})
 
 	if err != nil {
-		log.Printf("执行查询失败 [%s]: %v", metric.Query, err)
+		slog.Debug("执行查询失败", logging.KeyMetric, metric.Name, "query", metric.Query, logging.Err(err))
 		return "abnormal", err
 	}
 
 	switch v := result.(type) {
 	case model.Matrix:
 		if len(v) == 0 {
-			log.Printf("指标 [%s] 查询结果为空", metric.Name)
+			slog.Debug("指标查询结果为空", logging.KeyMetric, metric.Name)
 			return "abnormal", nil
 		}
 
-		log.Printf("指标 [%s] 返回 %d 个时间序列", metric.Name, len(v))
+		slog.Debug("指标查询返回时间序列", logging.KeyMetric, metric.Name, "series", len(v))
 
 		maxValue := float64(0)
 		// 遍历每个时间序列
@@ -212,26 +196,18 @@ PromQL: %s
 				if value > maxValue {
 					maxValue = value
 				}
-				log.Printf("指标 [%s] 时间: %v, 值: %v",
-					metric.Name,
-					sample.Timestamp.Time().Format("15:04:05"),
-					value)
 			}
 		}
 
 		// 使用最大值进行阈值判断
 		status := checkThreshold(maxValue, metric.Threshold, metric.ThresholdType)
-		log.Printf("指标 [%s] 最大值: %v, 阈值: %v, 阈值类型: %s, 状态: %s",
-			metric.Name,
-			maxValue,
-			metric.Threshold,
-			metric.ThresholdType,
-			status)
+		slog.Debug("指标状态判断", logging.KeyMetric, metric.Name, "max_value", maxValue,
+			"threshold", metric.Threshold, "threshold_type", metric.ThresholdType, "status", status)
 
 		return status, nil
 
 	default:
-		log.Printf("指标 [%s] 返回了意外的结果类型: %T", metric.Name, result)
+		slog.Warn("指标返回了意外的结果类型", logging.KeyMetric, metric.Name, "result_type", fmt.Sprintf("%T", result))
 		return "abnormal", nil
 	}
 }
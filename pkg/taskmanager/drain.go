@@ -0,0 +1,68 @@
+package taskmanager
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrShuttingDown 服务正在关闭，不再接受新的巡检
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Begin 登记一次即将开始的巡检（含通知发送），服务关闭中返回 ErrShuttingDown
+// 巡检结束后必须调用返回的函数
+func (tm *TaskManager) Begin() (func(), error) {
+	tm.drainMu.Lock()
+	defer tm.drainMu.Unlock()
+
+	select {
+	case <-tm.draining:
+		return nil, ErrShuttingDown
+	default:
+	}
+	tm.inflight.Add(1)
+	return tm.inflight.Done, nil
+}
+
+// StartDrain 停止接受新的巡检，可重复调用
+func (tm *TaskManager) StartDrain() {
+	tm.drainMu.Lock()
+	defer tm.drainMu.Unlock()
+
+	select {
+	case <-tm.draining:
+	default:
+		close(tm.draining)
+	}
+}
+
+// Draining 返回在服务开始关闭时关闭的通道
+func (tm *TaskManager) Draining() <-chan struct{} {
+	return tm.draining
+}
+
+// ShuttingDown 判断服务是否正在关闭
+func (tm *TaskManager) ShuttingDown() bool {
+	select {
+	case <-tm.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait 等待已登记的巡检全部结束，ctx 先到期时返回 ctx.Err()
+// 应在 StartDrain 之后调用，否则可能有新的巡检持续登记
+func (tm *TaskManager) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		tm.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,177 @@
+package taskmanager
+
+import (
+	"time"
+
+	"PromAI/pkg/redact"
+)
+
+// TaskEventType 任务事件类型
+type TaskEventType string
+
+const (
+	EventSnapshot TaskEventType = "snapshot" // 订阅时推送的任务快照
+	EventStep     TaskEventType = "step"     // 步骤状态变化
+	EventMetric   TaskEventType = "metric"   // 单个指标查询完成
+	EventLog      TaskEventType = "log"      // 新增日志
+	EventStatus   TaskEventType = "status"   // 任务状态变化
+)
+
+// subscriberBuffer 每个订阅者的事件缓冲区大小，写满后关闭该订阅者的通道避免阻塞巡检
+const subscriberBuffer = 64
+
+// CollectProgressWeight 指标收集阶段在总进度中所占的百分比，之后各阶段的进度从该值开始
+const CollectProgressWeight = 80
+
+// MetricProgress 指标收集进度
+type MetricProgress struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	Error string `json:"error,omitempty"`
+}
+
+// TaskEvent 任务事件，通过SSE推送给前端
+type TaskEvent struct {
+	Type     TaskEventType   `json:"type"`
+	TaskID   string          `json:"taskId"`
+	Time     time.Time       `json:"time"`
+	Status   TaskStatus      `json:"status"`
+	Progress int             `json:"progress"`
+	Step     *TaskStep       `json:"step,omitempty"`
+	Metric   *MetricProgress `json:"metric,omitempty"`
+	Log      *TaskLog        `json:"log,omitempty"`
+	Task     *InspectionTask `json:"task,omitempty"`
+}
+
+// Finished 判断任务状态是否为终态
+func (s TaskStatus) Finished() bool {
+	return s == StatusCompleted || s == StatusCompletedWithWarnings || s == StatusFailed
+}
+
+// Subscribe 订阅任务事件，返回事件通道和取消订阅函数
+// 订阅者消费过慢导致缓冲区写满时通道被关闭，订阅者应重新订阅并以任务快照恢复状态
+func (tm *TaskManager) Subscribe(id string) (<-chan TaskEvent, func()) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	ch := make(chan TaskEvent, subscriberBuffer)
+	if tm.subscribers[id] == nil {
+		tm.subscribers[id] = make(map[chan TaskEvent]struct{})
+	}
+	tm.subscribers[id][ch] = struct{}{}
+
+	return ch, func() {
+		tm.mu.Lock()
+		defer tm.mu.Unlock()
+		tm.unsubscribeLocked(id, ch)
+	}
+}
+
+// unsubscribeLocked 移除订阅者并关闭其通道，已移除时不做任何操作，调用方需持有写锁
+func (tm *TaskManager) unsubscribeLocked(id string, ch chan TaskEvent) {
+	if _, exists := tm.subscribers[id][ch]; !exists {
+		return
+	}
+	delete(tm.subscribers[id], ch)
+	if len(tm.subscribers[id]) == 0 {
+		delete(tm.subscribers, id)
+	}
+	close(ch)
+}
+
+// GetTaskSnapshot 获取任务的只读副本，避免与巡检协程并发读写
+func (tm *TaskManager) GetTaskSnapshot(id string) (InspectionTask, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	task, exists := tm.tasks[id]
+	if !exists {
+		return InspectionTask{}, false
+	}
+	return task.snapshot(), true
+}
+
+// ReportMetricProgress 上报单个指标的收集结果，并按已完成/总数计算进度
+// 查询失败时错误明细会记录到当前运行中的步骤
+func (tm *TaskManager) ReportMetricProgress(id string, progress MetricProgress) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	task, exists := tm.tasks[id]
+	if !exists {
+		return
+	}
+	progress.Error = redact.String(progress.Error)
+	if progress.Total > 0 {
+		task.Progress = progress.Done * CollectProgressWeight / progress.Total
+	}
+
+	tm.publishLocked(task, TaskEvent{Type: EventMetric, Metric: &progress})
+
+	if progress.Error != "" {
+		for i, step := range task.Steps {
+			if step.Status == StatusRunning {
+				task.Steps[i].Errors = append(task.Steps[i].Errors, progress.Name+": "+progress.Error)
+				tm.publishStepLocked(task, i)
+				break
+			}
+		}
+		tm.appendLogLocked(task, "查询指标 "+progress.Name+" 失败: "+progress.Error, "error")
+	}
+}
+
+// snapshot 复制任务数据，调用方需持有锁
+func (t *InspectionTask) snapshot() InspectionTask {
+	cp := *t
+	cp.Steps = make([]TaskStep, len(t.Steps))
+	for i, step := range t.Steps {
+		step.Errors = append([]string(nil), step.Errors...)
+		cp.Steps[i] = step
+	}
+	cp.Logs = append([]TaskLog(nil), t.Logs...)
+	cp.Options.MetricTypes = append([]string(nil), t.Options.MetricTypes...)
+	cp.Options.Tags = append([]string(nil), t.Options.Tags...)
+	return cp
+}
+
+// publishLocked 向订阅者广播事件，调用方需持有写锁
+func (tm *TaskManager) publishLocked(task *InspectionTask, event TaskEvent) {
+	subs := tm.subscribers[task.ID]
+	if len(subs) == 0 {
+		return
+	}
+
+	event.TaskID = task.ID
+	event.Time = time.Now()
+	event.Status = task.Status
+	event.Progress = task.Progress
+
+	for ch := range subs {
+		select {
+		case ch <- event:
+		default:
+			// 订阅者消费过慢，丢弃事件会导致其错过状态变化，关闭通道让其重新订阅获取快照
+			tm.unsubscribeLocked(task.ID, ch)
+		}
+	}
+}
+
+// appendLogLocked 追加任务日志并广播，调用方需持有写锁
+func (tm *TaskManager) appendLogLocked(task *InspectionTask, message, logType string) {
+	entry := TaskLog{
+		Time:    time.Now(),
+		Message: redact.String(message),
+		Type:    logType,
+	}
+	task.Logs = append(task.Logs, entry)
+	tm.publishLocked(task, TaskEvent{Type: EventLog, Log: &entry})
+}
+
+// publishStepLocked 广播步骤状态变化，调用方需持有写锁
+func (tm *TaskManager) publishStepLocked(task *InspectionTask, index int) {
+	step := task.Steps[index]
+	step.Errors = append([]string(nil), step.Errors...)
+	tm.publishLocked(task, TaskEvent{Type: EventStep, Step: &step})
+}
@@ -0,0 +1,31 @@
+package taskmanager
+
+import "testing"
+
+func TestSlowSubscriberIsClosed(t *testing.T) {
+	tm := NewTaskManager()
+	task := tm.CreateTask("巡检", "", nil)
+
+	events, unsubscribe := tm.Subscribe(task.ID)
+	for i := 0; i <= subscriberBuffer; i++ {
+		tm.ReportMetricProgress(task.ID, MetricProgress{Name: "up", Done: i, Total: subscriberBuffer + 1})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Fatalf("received %d events before close, want %d", received, subscriberBuffer)
+	}
+	// 已被关闭的订阅再次取消不应 panic
+	unsubscribe()
+
+	// 重新订阅后可以继续收到事件
+	events, unsubscribe = tm.Subscribe(task.ID)
+	defer unsubscribe()
+	tm.ReportMetricProgress(task.ID, MetricProgress{Name: "up", Done: 1, Total: 1})
+	if event := <-events; event.Type != EventMetric || event.Progress != CollectProgressWeight {
+		t.Fatalf("got event %+v, want metric event with progress %d", event, CollectProgressWeight)
+	}
+}
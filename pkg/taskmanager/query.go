@@ -0,0 +1,158 @@
+package taskmanager
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaskFilter 任务列表查询条件，零值字段表示不过滤
+type TaskFilter struct {
+	Statuses   []TaskStatus // 任一状态匹配即可
+	Datasource string       // 匹配任务数据源或请求中的数据源参数
+	Name       string       // 任务名称包含该字符串（不区分大小写）
+	Since      time.Time    // 开始时间不早于
+	Until      time.Time    // 开始时间早于
+	Ascending  bool         // 按开始时间升序，默认降序
+	Offset     int
+	Limit      int                        // 0 表示不限制
+	Allow      func(*InspectionTask) bool // 额外的可见性判断（如数据源权限范围），调用时持有读锁，不得修改任务
+}
+
+// DatasourceStats 单个数据源的任务统计
+type DatasourceStats struct {
+	Datasource         string             `json:"datasource"`
+	Count              int                `json:"count"`
+	ByStatus           map[TaskStatus]int `json:"byStatus"`
+	AvgDurationSeconds float64            `json:"avgDurationSeconds"`
+	P95DurationSeconds float64            `json:"p95DurationSeconds"`
+}
+
+// TaskStats 时间段内的任务统计
+type TaskStats struct {
+	Since        time.Time          `json:"since"`
+	Until        time.Time          `json:"until"`
+	Total        int                `json:"total"`
+	ByStatus     map[TaskStatus]int `json:"byStatus"`
+	ByDatasource []DatasourceStats  `json:"byDatasource"`
+}
+
+// matches 判断任务是否满足查询条件
+func (f TaskFilter) matches(task *InspectionTask) bool {
+	if len(f.Statuses) > 0 {
+		matched := false
+		for _, status := range f.Statuses {
+			if task.Status == status {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if f.Datasource != "" && task.Datasource != f.Datasource && task.Options.Datasource != f.Datasource {
+		return false
+	}
+	if f.Name != "" && !strings.Contains(strings.ToLower(task.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+	if !f.Since.IsZero() && task.StartTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !task.StartTime.Before(f.Until) {
+		return false
+	}
+	if f.Allow != nil && !f.Allow(task) {
+		return false
+	}
+	return true
+}
+
+// ListTasks 按条件查询任务，返回当前页的任务副本和满足条件的总数
+func (tm *TaskManager) ListTasks(filter TaskFilter) ([]InspectionTask, int) {
+	tm.mu.RLock()
+	matched := make([]InspectionTask, 0, len(tm.tasks))
+	for _, task := range tm.tasks {
+		if filter.matches(task) {
+			matched = append(matched, task.snapshot())
+		}
+	}
+	tm.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if filter.Ascending {
+			return matched[i].StartTime.Before(matched[j].StartTime)
+		}
+		return matched[i].StartTime.After(matched[j].StartTime)
+	})
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []InspectionTask{}, total
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(matched) {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total
+}
+
+// Stats 统计 [filter.Since, filter.Until) 内开始且满足过滤条件的任务：按状态计数，以及每个数据源已结束任务的平均和P95耗时
+// 分页和排序字段被忽略
+func (tm *TaskManager) Stats(filter TaskFilter) TaskStats {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	stats := TaskStats{
+		Since:        filter.Since,
+		Until:        filter.Until,
+		ByStatus:     make(map[TaskStatus]int),
+		ByDatasource: []DatasourceStats{},
+	}
+
+	byDatasource := make(map[string]*DatasourceStats)
+	durations := make(map[string][]float64)
+
+	for _, task := range tm.tasks {
+		if !filter.matches(task) {
+			continue
+		}
+		stats.Total++
+		stats.ByStatus[task.Status]++
+
+		ds, exists := byDatasource[task.Datasource]
+		if !exists {
+			ds = &DatasourceStats{Datasource: task.Datasource, ByStatus: make(map[TaskStatus]int)}
+			byDatasource[task.Datasource] = ds
+		}
+		ds.Count++
+		ds.ByStatus[task.Status]++
+
+		if task.Status.Finished() && !task.EndTime.IsZero() {
+			durations[task.Datasource] = append(durations[task.Datasource], task.EndTime.Sub(task.StartTime).Seconds())
+		}
+	}
+
+	for name, ds := range byDatasource {
+		values := durations[name]
+		if len(values) > 0 {
+			sort.Float64s(values)
+			sum := 0.0
+			for _, v := range values {
+				sum += v
+			}
+			ds.AvgDurationSeconds = sum / float64(len(values))
+			// 最近秩法计算P95
+			rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+			ds.P95DurationSeconds = values[rank]
+		}
+		stats.ByDatasource = append(stats.ByDatasource, *ds)
+	}
+	sort.Slice(stats.ByDatasource, func(i, j int) bool {
+		return stats.ByDatasource[i].Datasource < stats.ByDatasource[j].Datasource
+	})
+
+	return stats
+}
@@ -2,9 +2,16 @@ package taskmanager
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"sync"
 	"time"
+
+	"PromAI/pkg/logging"
+	"PromAI/pkg/redact"
 )
 
 // TaskStatus 任务状态类型
@@ -15,6 +22,15 @@ const (
 	StatusRunning   TaskStatus = "running"
 	StatusCompleted TaskStatus = "completed"
 	StatusFailed    TaskStatus = "failed"
+	// StatusCompletedWithWarnings 报告已生成，但部分步骤（如通知发送）失败
+	StatusCompletedWithWarnings TaskStatus = "completed_with_warnings"
+)
+
+var (
+	// ErrTaskNotFound 任务不存在或已被清理
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskFinished 任务已结束，不能再取消
+	ErrTaskFinished = errors.New("task already finished")
 )
 
 // TaskStep 任务步骤
@@ -24,6 +40,7 @@ type TaskStep struct {
 	StartTime   time.Time  `json:"startTime"`
 	EndTime     time.Time  `json:"endTime,omitempty"`
 	Error       string     `json:"error,omitempty"`
+	Errors      []string   `json:"errors,omitempty"` // 步骤内非致命错误明细，如单个指标查询失败
 	Description string     `json:"description"`
 }
 
@@ -34,60 +51,83 @@ type TaskLog struct {
 	Type    string    `json:"type"` // info, success, error
 }
 
+// TaskOptions 巡检任务的执行参数，重试时按相同参数重新执行
+type TaskOptions struct {
+	Datasource   string   `json:"datasource,omitempty"`  // 请求中的数据源名称或URL，为空时使用默认数据源
+	MetricTypes  []string `json:"metricTypes,omitempty"` // 仅巡检指定的指标类型，为空时巡检全部
+	Tags         []string `json:"tags,omitempty"`        // 仅巡检带有其中任一标签的指标，为空时不按标签筛选
+	WeChatBotKey string   `json:"-"`                     // 请求指定的企业微信机器人key
+}
+
+// MarshalJSON 输出时隐藏数据源URL中的敏感信息，任务内部保留原值用于重试
+func (o TaskOptions) MarshalJSON() ([]byte, error) {
+	type plain TaskOptions
+	p := plain(o)
+	p.Datasource = redact.String(p.Datasource)
+	return json.Marshal(p)
+}
+
 // InspectionTask 巡检任务
 type InspectionTask struct {
-	ID          string                `json:"id"`
-	Name        string                `json:"name"`
-	Datasource  string                `json:"datasource"`
-	Status      TaskStatus            `json:"status"`
-	Progress    int                   `json:"progress"`
-	StartTime   time.Time             `json:"startTime"`
-	EndTime     time.Time             `json:"endTime,omitempty"`
-	Error       string                `json:"error,omitempty"`
-	Steps       []TaskStep            `json:"steps"`
-	Logs        []TaskLog             `json:"logs"`
-	ReportPath  string                `json:"reportPath,omitempty"`
-	ctx         context.Context       `json:"-"`
-	cancel      context.CancelFunc    `json:"-"`
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Datasource string             `json:"datasource"`
+	Status     TaskStatus         `json:"status"`
+	Progress   int                `json:"progress"`
+	StartTime  time.Time          `json:"startTime"`
+	EndTime    time.Time          `json:"endTime,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	Steps      []TaskStep         `json:"steps"`
+	Logs       []TaskLog          `json:"logs"`
+	ReportPath string             `json:"reportPath,omitempty"`
+	Options    TaskOptions        `json:"options"`
+	RetryOf    string             `json:"retryOf,omitempty"` // 被重试的原始任务ID
+	Attempt    int                `json:"attempt"`           // 第几次执行，首次为1
+	ctx        context.Context    `json:"-"`
+	cancel     context.CancelFunc `json:"-"`
 }
 
 // TaskManager 任务管理器
 type TaskManager struct {
-	mu     sync.RWMutex
-	tasks  map[string]*InspectionTask
-	nextID int
+	mu          sync.RWMutex
+	tasks       map[string]*InspectionTask
+	subscribers map[string]map[chan TaskEvent]struct{}
+	nextID      int
+
+	// 优雅关闭：draining 关闭后不再接受新的巡检，inflight 记录执行中的巡检
+	drainMu  sync.Mutex
+	draining chan struct{}
+	inflight sync.WaitGroup
 }
 
 // NewTaskManager 创建新的任务管理器
 func NewTaskManager() *TaskManager {
 	return &TaskManager{
-		tasks: make(map[string]*InspectionTask),
+		tasks:       make(map[string]*InspectionTask),
+		subscribers: make(map[string]map[chan TaskEvent]struct{}),
+		draining:    make(chan struct{}),
 	}
 }
 
-// CreateTask 创建新的巡检任务
-func (tm *TaskManager) CreateTask(name, datasource string) *InspectionTask {
+// CreateTask 创建新的巡检任务，steps 为根据配置生成的执行步骤
+func (tm *TaskManager) CreateTask(name, datasource string, steps []TaskStep) *InspectionTask {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
 	tm.nextID++
-	id := "task_" + time.Now().Format("20060102_150405") + "_" + string(tm.nextID)
+	id := "task_" + time.Now().Format("20060102_150405") + "_" + strconv.Itoa(tm.nextID)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	task := &InspectionTask{
 		ID:         id,
 		Name:       name,
-		Datasource: datasource,
+		Datasource: redact.String(datasource),
 		Status:     StatusPending,
 		Progress:   0,
 		StartTime:  time.Now(),
-		Steps: []TaskStep{
-			{Name: "收集系统资源数据", Status: StatusPending, Description: "收集CPU、内存、磁盘等基础指标"},
-			{Name: "收集服务状态", Status: StatusPending, Description: "检查各项服务的运行状态"},
-			{Name: "分析告警信息", Status: StatusPending, Description: "分析当前告警和异常"},
-			{Name: "生成巡检报告", Status: StatusPending, Description: "生成HTML格式巡检报告"},
-		},
+		Steps:      append([]TaskStep(nil), steps...),
+		Attempt:    1,
 		Logs: []TaskLog{
 			{Time: time.Now(), Message: "巡检任务已创建", Type: "info"},
 		},
@@ -99,6 +139,42 @@ func (tm *TaskManager) CreateTask(name, datasource string) *InspectionTask {
 	return task
 }
 
+// PrepareTask 设置待执行任务的执行参数和步骤，任务已开始执行时返回 false
+func (tm *TaskManager) PrepareTask(id string, opts TaskOptions, steps []TaskStep) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	task, exists := tm.tasks[id]
+	if !exists || task.Status != StatusPending {
+		return false
+	}
+	task.Options = opts
+	task.Steps = append([]TaskStep(nil), steps...)
+	return true
+}
+
+// CreateRetryTask 以原任务的名称、数据源和执行参数创建重试任务
+func (tm *TaskManager) CreateRetryTask(originalID string, steps []TaskStep) (*InspectionTask, error) {
+	original, exists := tm.GetTaskSnapshot(originalID)
+	if !exists {
+		return nil, fmt.Errorf("task %s not found", originalID)
+	}
+	if !original.Status.Finished() {
+		return nil, fmt.Errorf("task %s is still %s", originalID, original.Status)
+	}
+
+	task := tm.CreateTask(original.Name, original.Datasource, steps)
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	task.Options = original.Options
+	task.RetryOf = original.ID
+	task.Attempt = original.Attempt + 1
+	tm.appendLogLocked(task, "重试任务 "+original.ID+"，第 "+strconv.Itoa(task.Attempt)+" 次执行", "info")
+	return task, nil
+}
+
 // GetTask 获取任务
 func (tm *TaskManager) GetTask(id string) (*InspectionTask, bool) {
 	tm.mu.RLock()
@@ -108,6 +184,17 @@ func (tm *TaskManager) GetTask(id string) (*InspectionTask, bool) {
 	return task, exists
 }
 
+// TaskContext 获取任务的上下文，任务被取消时该上下文随之取消
+func (tm *TaskManager) TaskContext(id string) context.Context {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	if task, exists := tm.tasks[id]; exists && task.ctx != nil {
+		return task.ctx
+	}
+	return context.Background()
+}
+
 // GetAllTasks 获取所有任务
 func (tm *TaskManager) GetAllTasks() []*InspectionTask {
 	tm.mu.RLock()
@@ -141,21 +228,38 @@ func (tm *TaskManager) UpdateTaskProgress(id string, progress int, stepName stri
 
 	if task, exists := tm.tasks[id]; exists {
 		task.Progress = progress
+		if task.Status == StatusPending {
+			task.Status = StatusRunning
+			tm.publishLocked(task, TaskEvent{Type: EventStatus})
+		}
 
 		// 更新步骤状态
 		for i, step := range task.Steps {
 			if step.Name == stepName && step.Status == StatusPending {
 				task.Steps[i].Status = StatusRunning
 				task.Steps[i].StartTime = time.Now()
+				tm.publishStepLocked(task, i)
 				break
 			}
 		}
 
-		task.Logs = append(task.Logs, TaskLog{
-			Time:    time.Now(),
-			Message: stepName,
-			Type:    "info",
-		})
+		tm.appendLogLocked(task, stepName, "info")
+	}
+}
+
+// AddStep 为任务追加步骤，同名步骤已存在时忽略
+func (tm *TaskManager) AddStep(id string, step TaskStep) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if task, exists := tm.tasks[id]; exists {
+		for _, existing := range task.Steps {
+			if existing.Name == step.Name {
+				return
+			}
+		}
+		task.Steps = append(task.Steps, step)
+		tm.publishStepLocked(task, len(task.Steps)-1)
 	}
 }
 
@@ -169,15 +273,12 @@ func (tm *TaskManager) CompleteStep(id string, stepName string) {
 			if step.Name == stepName {
 				task.Steps[i].Status = StatusCompleted
 				task.Steps[i].EndTime = time.Now()
+				tm.publishStepLocked(task, i)
 				break
 			}
 		}
 
-		task.Logs = append(task.Logs, TaskLog{
-			Time:    time.Now(),
-			Message: stepName + " 完成",
-			Type:    "success",
-		})
+		tm.appendLogLocked(task, stepName+" 完成", "success")
 	}
 }
 
@@ -186,31 +287,39 @@ func (tm *TaskManager) FailStep(id string, stepName, errorMsg string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	errorMsg = redact.String(errorMsg)
 	if task, exists := tm.tasks[id]; exists {
 		for i, step := range task.Steps {
 			if step.Name == stepName {
 				task.Steps[i].Status = StatusFailed
 				task.Steps[i].EndTime = time.Now()
 				task.Steps[i].Error = errorMsg
+				tm.publishStepLocked(task, i)
 				break
 			}
 		}
 
-		task.Logs = append(task.Logs, TaskLog{
-			Time:    time.Now(),
-			Message: stepName + " 失败: " + errorMsg,
-			Type:    "error",
-		})
+		tm.appendLogLocked(task, stepName+" 失败: "+errorMsg, "error")
 	}
 }
 
-// CompleteTask 完成任务
+// CompleteTask 完成任务，存在失败步骤时以 completed_with_warnings 结束；任务已结束（如已被取消）时不做任何操作
 func (tm *TaskManager) CompleteTask(id string, reportPath string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	if task, exists := tm.tasks[id]; exists {
+	if task, exists := tm.tasks[id]; exists && !task.Status.Finished() {
+		failedSteps := 0
+		for _, step := range task.Steps {
+			if step.Status == StatusFailed {
+				failedSteps++
+			}
+		}
+
 		task.Status = StatusCompleted
+		if failedSteps > 0 {
+			task.Status = StatusCompletedWithWarnings
+		}
 		task.Progress = 100
 
 		// 记录任务完成时间
@@ -220,57 +329,58 @@ func (tm *TaskManager) CompleteTask(id string, reportPath string) {
 		// 调试信息：检查时间差
 		if !task.StartTime.IsZero() {
 			duration := beforeEndTime.Sub(task.StartTime)
-			log.Printf("[DEBUG] 任务 %s 完成，耗时: %v, 开始时间: %v, 结束时间: %v",
-				id, duration, task.StartTime, beforeEndTime)
+			slog.Debug("任务完成", logging.KeyTaskID, id, "duration", duration, "start_time", task.StartTime, "end_time", beforeEndTime)
 		}
 
 		task.ReportPath = reportPath
 
-		task.Logs = append(task.Logs, TaskLog{
-			Time:    time.Now(),
-			Message: "巡检任务完成！",
-			Type:    "success",
-		})
+		if failedSteps > 0 {
+			tm.appendLogLocked(task, "巡检任务完成，但有 "+strconv.Itoa(failedSteps)+" 个步骤失败", "error")
+		} else {
+			tm.appendLogLocked(task, "巡检任务完成！", "success")
+		}
+		tm.publishLocked(task, TaskEvent{Type: EventStatus})
 	}
 }
 
-// FailTask 任务失败
+// FailTask 任务失败，任务已结束（如已被取消）时不做任何操作
 func (tm *TaskManager) FailTask(id string, errorMsg string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	if task, exists := tm.tasks[id]; exists {
+	errorMsg = redact.String(errorMsg)
+	if task, exists := tm.tasks[id]; exists && !task.Status.Finished() {
 		task.Status = StatusFailed
 		task.Error = errorMsg
 		task.EndTime = time.Now()
 
-		task.Logs = append(task.Logs, TaskLog{
-			Time:    time.Now(),
-			Message: "巡检任务失败: " + errorMsg,
-			Type:    "error",
-		})
+		tm.appendLogLocked(task, "巡检任务失败: "+errorMsg, "error")
+		tm.publishLocked(task, TaskEvent{Type: EventStatus})
 	}
 }
 
-// CancelTask 取消任务
-func (tm *TaskManager) CancelTask(id string) {
+// CancelTask 取消任务，任务不存在时返回 ErrTaskNotFound，已结束时返回 ErrTaskFinished 且不改变任务状态
+func (tm *TaskManager) CancelTask(id string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	if task, exists := tm.tasks[id]; exists {
-		if task.cancel != nil {
-			task.cancel()
-		}
-		task.Status = StatusFailed
-		task.Error = "任务已取消"
-		task.EndTime = time.Now()
-
-		task.Logs = append(task.Logs, TaskLog{
-			Time:    time.Now(),
-			Message: "巡检任务已取消",
-			Type:    "error",
-		})
+	task, exists := tm.tasks[id]
+	if !exists {
+		return ErrTaskNotFound
 	}
+	if task.Status.Finished() {
+		return fmt.Errorf("%w: task %s is %s", ErrTaskFinished, id, task.Status)
+	}
+	if task.cancel != nil {
+		task.cancel()
+	}
+	task.Status = StatusFailed
+	task.Error = "任务已取消"
+	task.EndTime = time.Now()
+
+	tm.appendLogLocked(task, "巡检任务已取消", "error")
+	tm.publishLocked(task, TaskEvent{Type: EventStatus})
+	return nil
 }
 
 // CleanupOldTasks 清理旧任务（保留最近24小时的任务）
@@ -286,4 +396,4 @@ func (tm *TaskManager) CleanupOldTasks() {
 	}
 }
 
-var GlobalTaskManager = NewTaskManager()
\ No newline at end of file
+var GlobalTaskManager = NewTaskManager()
@@ -0,0 +1,59 @@
+package taskmanager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCancelTask(t *testing.T) {
+	tm := NewTaskManager()
+	if err := tm.CancelTask("missing"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("CancelTask(missing) = %v, want ErrTaskNotFound", err)
+	}
+
+	task := tm.CreateTask("巡检", "", nil)
+	if err := tm.CancelTask(task.ID); err != nil {
+		t.Fatalf("CancelTask() = %v", err)
+	}
+	if err := tm.CancelTask(task.ID); !errors.Is(err, ErrTaskFinished) {
+		t.Fatalf("second CancelTask() = %v, want ErrTaskFinished", err)
+	}
+
+	// 仍在执行的巡检协程结束时不能覆盖取消状态
+	tm.CompleteTask(task.ID, "reports/inspection_report.html")
+	tm.FailTask(task.ID, "context canceled")
+	got, _ := tm.GetTaskSnapshot(task.ID)
+	if got.Status != StatusFailed || got.Error != "任务已取消" || got.ReportPath != "" {
+		t.Fatalf("task after cancel = status %q, error %q, report %q; want failed, 任务已取消, no report", got.Status, got.Error, got.ReportPath)
+	}
+}
+
+func TestCancelFinishedTask(t *testing.T) {
+	tests := []struct {
+		name   string
+		finish func(tm *TaskManager, id string)
+		want   TaskStatus
+	}{
+		{name: "completed", finish: func(tm *TaskManager, id string) { tm.CompleteTask(id, "reports/a.html") }, want: StatusCompleted},
+		{name: "completed_with_warnings", finish: func(tm *TaskManager, id string) {
+			tm.FailStep(id, "发送通知", "webhook returned 500")
+			tm.CompleteTask(id, "reports/a.html")
+		}, want: StatusCompletedWithWarnings},
+		{name: "failed", finish: func(tm *TaskManager, id string) { tm.FailTask(id, "all queries failed") }, want: StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTaskManager()
+			task := tm.CreateTask("巡检", "", []TaskStep{{Name: "发送通知", Status: StatusRunning}})
+			tt.finish(tm, task.ID)
+
+			if err := tm.CancelTask(task.ID); !errors.Is(err, ErrTaskFinished) {
+				t.Fatalf("CancelTask() = %v, want ErrTaskFinished", err)
+			}
+			got, _ := tm.GetTaskSnapshot(task.ID)
+			if got.Status != tt.want || got.Error == "任务已取消" {
+				t.Fatalf("status after cancel = %q (error %q), want %q unchanged", got.Status, got.Error, tt.want)
+			}
+		})
+	}
+}
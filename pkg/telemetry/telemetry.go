@@ -0,0 +1,216 @@
+package telemetry
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"PromAI/pkg/taskmanager"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "promai"
+
+// 定时任务名称，用作 schedule 标签
+const (
+	ScheduleInspection    = "inspection"
+	ScheduleReportCleanup = "report_cleanup"
+)
+
+// reportsDir 报告目录，与报告生成和清理使用的目录一致
+const reportsDir = "reports"
+
+var (
+	inspectionRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "inspection_runs_total",
+		Help:      "Number of finished inspection runs by datasource and final task status.",
+	}, []string{"datasource", "status"})
+
+	inspectionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "inspection_duration_seconds",
+		Help:      "Duration of inspection runs by datasource.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"datasource"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "metric_query_duration_seconds",
+		Help:      "Latency of inspection metric queries against Prometheus.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"metric_type", "metric"})
+
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "metric_query_errors_total",
+		Help:      "Number of failed inspection metric queries.",
+	}, []string{"metric_type", "metric"})
+
+	scheduleLastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "schedule_last_run_timestamp_seconds",
+		Help:      "Unix timestamp of the last run of each cron schedule.",
+	}, []string{"schedule"})
+
+	scheduleLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "schedule_last_run_success",
+		Help:      "Whether the last run of each cron schedule succeeded (1) or failed (0).",
+	}, []string{"schedule"})
+
+	notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Number of notification sends by channel and result.",
+	}, []string{"channel", "result"})
+
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Number of configuration reload attempts by result.",
+	}, []string{"result"})
+
+	configLastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt succeeded (1) or failed (0).",
+	})
+
+	configLastReloadTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful configuration load.",
+	})
+
+	taskQueueDepth = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_queue_depth"),
+		"Number of inspection tasks waiting or running, by status.",
+		[]string{"status"}, nil,
+	)
+
+	reportDirBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "report_directory_bytes"),
+		"Total size of files in the reports directory.",
+		nil, nil,
+	)
+
+	reportFiles = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "report_files"),
+		"Number of files in the reports directory.",
+		nil, nil,
+	)
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		inspectionRuns,
+		inspectionDuration,
+		queryDuration,
+		queryErrors,
+		scheduleLastRun,
+		scheduleLastSuccess,
+		notifications,
+		configReloads,
+		configLastReloadSuccess,
+		configLastReloadTime,
+		stateCollector{},
+	)
+}
+
+// Handler 返回 /metrics 处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// ObserveInspection 记录一次巡检运行的结果和耗时
+func ObserveInspection(datasource, status string, duration time.Duration) {
+	inspectionRuns.WithLabelValues(datasource, status).Inc()
+	inspectionDuration.WithLabelValues(datasource).Observe(duration.Seconds())
+}
+
+// ObserveQuery 记录单个指标查询的耗时，查询失败时增加错误计数
+func ObserveQuery(metricType, metric string, duration time.Duration, err error) {
+	queryDuration.WithLabelValues(metricType, metric).Observe(duration.Seconds())
+	if err != nil {
+		queryErrors.WithLabelValues(metricType, metric).Inc()
+	}
+}
+
+// ObserveSchedule 记录定时任务的最近一次运行时间和结果
+func ObserveSchedule(schedule string, success bool) {
+	scheduleLastRun.WithLabelValues(schedule).SetToCurrentTime()
+	value := 0.0
+	if success {
+		value = 1
+	}
+	scheduleLastSuccess.WithLabelValues(schedule).Set(value)
+}
+
+// ObserveNotification 记录一次通知发送结果
+func ObserveNotification(channel string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	notifications.WithLabelValues(channel, result).Inc()
+}
+
+// ObserveConfigLoad 记录启动时配置加载成功
+func ObserveConfigLoad() {
+	configLastReloadSuccess.Set(1)
+	configLastReloadTime.SetToCurrentTime()
+}
+
+// ObserveConfigReload 记录一次配置重新加载的结果
+func ObserveConfigReload(err error) {
+	if err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		configLastReloadSuccess.Set(0)
+		return
+	}
+	configReloads.WithLabelValues("success").Inc()
+	ObserveConfigLoad()
+}
+
+// stateCollector 在抓取时统计任务队列和报告目录
+type stateCollector struct{}
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- taskQueueDepth
+	ch <- reportDirBytes
+	ch <- reportFiles
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := taskmanager.GlobalTaskManager.Stats(taskmanager.TaskFilter{
+		Statuses: []taskmanager.TaskStatus{taskmanager.StatusPending, taskmanager.StatusRunning},
+	})
+	for _, status := range []taskmanager.TaskStatus{taskmanager.StatusPending, taskmanager.StatusRunning} {
+		ch <- prometheus.MustNewConstMetric(taskQueueDepth, prometheus.GaugeValue, float64(stats.ByStatus[status]), string(status))
+	}
+
+	var size int64
+	var files int
+	// 目录不存在时按 0 上报
+	_ = filepath.Walk(reportsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	ch <- prometheus.MustNewConstMetric(reportDirBytes, prometheus.GaugeValue, float64(size))
+	ch <- prometheus.MustNewConstMetric(reportFiles, prometheus.GaugeValue, float64(files))
+}
@@ -1,14 +1,18 @@
 package utils
 
 import (
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"strings"
 )
 
-var globalPort string
+var (
+	globalPort  string
+	externalURL string
+	basePath    = "/api/promai"
+)
 
 func GetLocalIPs() []string {
 	interfaces, err := net.Interfaces()
@@ -49,6 +53,21 @@ func GetGlobalPort() string {
 	return globalPort
 }
 
+// SetExternalURL 设置用户访问 PromAI 的地址（server.external_url）
+func SetExternalURL(url string) {
+	externalURL = url
+}
+
+// SetBasePath 设置页面和接口的路由前缀（server.base_path）
+func SetBasePath(path string) {
+	basePath = path
+}
+
+// GetBasePath 获取页面和接口的路由前缀
+func GetBasePath() string {
+	return basePath
+}
+
 // GetServerURL 获取服务器的基础URL，支持动态域名获取
 func GetServerURL(r *http.Request) string {
 	// log.Printf("打印请求信息: %s", r)
@@ -71,15 +90,15 @@ func GetServerURL(r *http.Request) string {
 		externalPort := os.Getenv("EXTERNAL_PORT")
 		if externalPort != "" {
 			host = host + ":" + externalPort
-			log.Printf("EXTERNAL_PORT不为空,从环境变量获取外部端口: %s", host)
+			slog.Debug("EXTERNAL_PORT不为空，从环境变量获取外部端口", "host", host)
 		} else if globalPort != "" && globalPort != "80" && globalPort != "443" {
 			// 其次使用服务运行端口（如果不是标准端口）
 			host = host + ":" + globalPort
-			log.Printf("EXTERNAL_PORT为空,使用服务运行端口: %s", host)
+			slog.Debug("EXTERNAL_PORT为空，使用服务运行端口", "host", host)
 		}
 	}
 
-	log.Printf("GetServerURL调试: 最终Host: %s", host)
+	slog.Debug("生成服务访问地址", "host", host)
 
 	return scheme + "://" + host
 }
@@ -87,7 +106,22 @@ func GetServerURL(r *http.Request) string {
 // GetReportURL 获取报告访问URL
 func GetReportURL(r *http.Request, reportFileName string) string {
 	serverURL := GetServerURL(r)
-	return serverURL + "/api/promai/reports/" + reportFileName
+	return serverURL + basePath + "/reports/" + reportFileName
+}
+
+// ReportLink 生成通知中的报告链接：优先使用 server.external_url，其次根据触发巡检的HTTP请求推断，
+// 再次使用通知渠道中已废弃的 report_url，最后使用 REPORT_URL 环境变量或本机地址
+func ReportLink(r *http.Request, legacyReportURL, reportFileName string) string {
+	var serverURL string
+	switch {
+	case externalURL != "":
+		serverURL = externalURL
+	case r != nil:
+		serverURL = GetServerURL(r)
+	default:
+		serverURL = strings.TrimRight(GetServerURLFromContext(legacyReportURL), "/")
+	}
+	return serverURL + basePath + "/reports/" + reportFileName
 }
 
 // GetServerURLFromContext 从配置中获取服务器URL